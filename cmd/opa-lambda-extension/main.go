@@ -0,0 +1,38 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+// Command opa-lambda-extension runs OPA as a standalone Lambda Extension, without the OPA server.
+// The binary has to be placed in the extensions directory of a Lambda layer, i.e.
+// /opt/extensions/opa-lambda-extension.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/godaddy/opa-lambda-extension-plugin/plugins/lambda"
+)
+
+const defaultConfigFile = "/opt/opa/config.yaml"
+
+func main() {
+	configFileDefault := os.Getenv("OPA_LAMBDA_CONFIG_FILE")
+	if configFileDefault == "" {
+		configFileDefault = defaultConfigFile
+	}
+	configFile := flag.String("config-file", configFileDefault, "path of the OPA configuration file, defaults to $OPA_LAMBDA_CONFIG_FILE or "+defaultConfigFile)
+	flag.Parse()
+
+	config, err := ioutil.ReadFile(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := lambda.RunStandalone(context.Background(), config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -5,4 +5,5 @@ go 1.16
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/open-policy-agent/opa v0.32.0
+	github.com/sirupsen/logrus v1.8.1
 )
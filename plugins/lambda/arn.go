@@ -0,0 +1,111 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// FunctionARN is the parsed ARN of a Lambda function, e.g.
+// arn:aws:lambda:us-west-2:123456789012:function:my-function:prod.
+type FunctionARN struct {
+	Partition string
+	Region    string
+	AccountID string
+	Function  string
+	// The version or alias of the function, empty for an unqualified ARN
+	Qualifier string
+}
+
+// ParseFunctionARN parses a function ARN, qualified with a version or alias or not, like the
+// invokedFunctionArn of invoke events.
+func ParseFunctionARN(arn string) (*FunctionARN, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 7 || len(parts) > 8 || parts[0] != "arn" || parts[2] != "lambda" || parts[5] != "function" || parts[6] == "" {
+		return nil, fmt.Errorf("invalid function ARN %q", arn)
+	}
+	parsed := &FunctionARN{
+		Partition: parts[1],
+		Region:    parts[3],
+		AccountID: parts[4],
+		Function:  parts[6],
+	}
+	if len(parts) == 8 {
+		parsed.Qualifier = parts[7]
+	}
+	return parsed, nil
+}
+
+// String returns the ARN.
+func (a *FunctionARN) String() string {
+	arn := fmt.Sprintf("arn:%s:lambda:%s:%s:function:%s", a.Partition, a.Region, a.AccountID, a.Function)
+	if a.Qualifier != "" {
+		arn += ":" + a.Qualifier
+	}
+	return arn
+}
+
+// functionARNFromEnvironment returns the ARN of the function that the extension runs with,
+// qualified with the version. The environment doesn't tell the account, so it must be given.
+// The alias an invoke was made through is only known from the invoke event.
+func functionARNFromEnvironment(accountID string) *FunctionARN {
+	region := os.Getenv("AWS_REGION")
+	partition := "aws"
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		partition = "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		partition = "aws-us-gov"
+	}
+	return &FunctionARN{
+		Partition: partition,
+		Region:    region,
+		AccountID: accountID,
+		Function:  os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		Qualifier: os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+	}
+}
+
+var arnPlaceholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// arnPlaceholderValue returns the part of the ARN that a placeholder stands for.
+func arnPlaceholderValue(a *FunctionARN, name string) (string, bool) {
+	switch name {
+	case "partition":
+		return a.Partition, true
+	case "region":
+		return a.Region, true
+	case "account":
+		return a.AccountID, true
+	case "function":
+		return a.Function, true
+	case "qualifier":
+		return a.Qualifier, true
+	}
+	return "", false
+}
+
+// validateARNTemplate returns an error if a template has an unknown placeholder.
+func validateARNTemplate(template string) error {
+	for _, match := range arnPlaceholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := arnPlaceholderValue(&FunctionARN{}, match[1]); !ok {
+			return fmt.Errorf("unknown placeholder %q, must be one of {partition}, {region}, {account}, {function}, or {qualifier}", match[0])
+		}
+	}
+	return nil
+}
+
+// expandARNTemplate replaces the placeholders in a template, e.g. {account}/{function}, with the
+// parts of the ARN. Only label values are expanded.
+func expandARNTemplate(template string, a *FunctionARN) string {
+	return arnPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if value, ok := arnPlaceholderValue(a, placeholder[1:len(placeholder)-1]); ok {
+			return value
+		}
+		return placeholder
+	})
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFunctionARN(t *testing.T) {
+	arn, err := ParseFunctionARN("arn:aws:lambda:us-west-2:123456789012:function:my-function:prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &FunctionARN{Partition: "aws", Region: "us-west-2", AccountID: "123456789012", Function: "my-function", Qualifier: "prod"}
+	if !reflect.DeepEqual(arn, expected) {
+		t.Fatalf("Expected %v, got %v", expected, arn)
+	}
+	if arn.String() != "arn:aws:lambda:us-west-2:123456789012:function:my-function:prod" {
+		t.Fatalf("Expected the ARN to round trip, got %q", arn.String())
+	}
+
+	unqualified, err := ParseFunctionARN("arn:aws:lambda:us-west-2:123456789012:function:my-function")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unqualified.Qualifier != "" {
+		t.Fatalf("Expected no qualifier, got %q", unqualified.Qualifier)
+	}
+
+	for _, invalid := range []string{"", "my-function", "arn:aws:s3:::bucket", "arn:aws:lambda:us-west-2:123456789012:layer:my-layer:1"} {
+		if _, err := ParseFunctionARN(invalid); err == nil {
+			t.Fatalf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestExpandARNTemplate(t *testing.T) {
+	arn := &FunctionARN{Partition: "aws", Region: "us-west-2", AccountID: "123456789012", Function: "my-function", Qualifier: "3"}
+	if got := expandARNTemplate("{account}/{function}/{qualifier}", arn); got != "123456789012/my-function/3" {
+		t.Fatalf("Expected the template to be expanded, got %q", got)
+	}
+	if err := validateARNTemplate("{account}/{alias}"); err == nil {
+		t.Fatal("Expected an error for an unknown placeholder")
+	}
+}
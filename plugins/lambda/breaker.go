@@ -0,0 +1,115 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// circuitBreaker stops a plugin from being triggered after its triggers keep failing, e.g.
+// because the service that the decision_logs plugin uploads to is throttling, so a degraded
+// service doesn't use up the time the extension has for every event. Data the plugin buffers,
+// like decision logs, stays in its buffer until the breaker closes again, or until it is flushed
+// at shutdown, which bypasses the breaker. Once the cooldown has elapsed, the breaker is half open
+// and lets a single trigger through as a probe. The breaker closes if the probe succeeds, and
+// opens again if it fails.
+type circuitBreaker struct {
+	mtx       sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     string
+	openedAt  time.Time
+}
+
+// allow returns true if the plugin may be triggered.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// the probe is still running
+		return false
+	default:
+		return true
+	}
+}
+
+// record records the result of a trigger, and returns the new state of the breaker.
+func (b *circuitBreaker) record(now time.Time, err error) string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.state = breakerClosed
+		return b.state
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) currentState() string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.state
+}
+
+// circuitBreakers holds a circuit breaker for every plugin that has been triggered. It is nil when
+// the circuit breakers are disabled.
+type circuitBreakers struct {
+	mtx       sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(threshold int, cooldown time.Duration) *circuitBreakers {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreakers{threshold: threshold, cooldown: cooldown, breakers: map[string]*circuitBreaker{}}
+}
+
+func (c *circuitBreakers) get(pluginName string) *circuitBreaker {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	b, ok := c.breakers[pluginName]
+	if !ok {
+		b = &circuitBreaker{threshold: c.threshold, cooldown: c.cooldown, state: breakerClosed}
+		c.breakers[pluginName] = b
+	}
+	return b
+}
+
+// states returns the state of every breaker, keyed by plugin name.
+func (c *circuitBreakers) states() map[string]string {
+	if c == nil {
+		return nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	states := map[string]string{}
+	for pluginName, b := range c.breakers {
+		states[pluginName] = b.currentState()
+	}
+	return states
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreakers(2, time.Minute).get("decision_logs")
+	failure := errors.New("throttled")
+
+	if state := b.record(now, failure); state != breakerClosed {
+		t.Fatalf("Expected the breaker to stay closed after 1 failure, got %s", state)
+	}
+	if state := b.record(now, failure); state != breakerOpen {
+		t.Fatalf("Expected the breaker to open after 2 failures, got %s", state)
+	}
+	if b.allow(now.Add(30 * time.Second)) {
+		t.Fatal("Expected the open breaker not to allow triggers during the cooldown")
+	}
+
+	// a single probe is allowed once the cooldown has elapsed, and a failed probe opens the
+	// breaker again
+	if !b.allow(now.Add(time.Minute)) {
+		t.Fatal("Expected the breaker to allow a probe after the cooldown")
+	}
+	if b.allow(now.Add(time.Minute)) {
+		t.Fatal("Expected the half open breaker to allow only one probe")
+	}
+	if state := b.record(now.Add(time.Minute), failure); state != breakerOpen {
+		t.Fatalf("Expected the breaker to open after a failed probe, got %s", state)
+	}
+
+	// a successful probe closes the breaker
+	if !b.allow(now.Add(2 * time.Minute)) {
+		t.Fatal("Expected the breaker to allow a probe after the cooldown")
+	}
+	if state := b.record(now.Add(2*time.Minute), nil); state != breakerClosed {
+		t.Fatalf("Expected the breaker to close after a successful probe, got %s", state)
+	}
+	if !b.allow(now.Add(2 * time.Minute)) {
+		t.Fatal("Expected the closed breaker to allow triggers")
+	}
+}
+
+func TestCircuitBreakersDisabled(t *testing.T) {
+	if b := newCircuitBreakers(0, time.Minute); b != nil {
+		t.Fatalf("Expected no circuit breakers, got %v", b)
+	}
+}
+
+func TestFlushBypassesOpenBreaker(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPlugin(t, `{"breaker_threshold": 1}`)
+	logs := &triggerablePlugin{err: errors.New("throttled")}
+	p.manager.Register("decision_logs", logs)
+
+	p.triggerPlugin(ctx, "decision_logs")
+	p.triggerPlugin(ctx, "decision_logs")
+	if logs.triggers != 1 {
+		t.Fatalf("Expected the open breaker to skip the second trigger, got %d triggers", logs.triggers)
+	}
+	p.Flush(ctx)
+	if logs.triggers != 2 {
+		t.Fatalf("Expected Flush to trigger the plugin despite the open breaker, got %d triggers", logs.triggers)
+	}
+}
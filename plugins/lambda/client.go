@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 // RegisterResponse is the body of the response for /register
@@ -20,6 +21,8 @@ type RegisterResponse struct {
 	FunctionName    string `json:"functionName"`
 	FunctionVersion string `json:"functionVersion"`
 	Handler         string `json:"handler"`
+	// The account ID of the function, only sent when the extension accepts the accountId feature
+	AccountID string `json:"accountId,omitempty"`
 }
 
 // NextEventResponse is the response for /event/next
@@ -29,6 +32,15 @@ type NextEventResponse struct {
 	RequestID          string    `json:"requestId"`
 	InvokedFunctionArn string    `json:"invokedFunctionArn"`
 	Tracing            Tracing   `json:"tracing"`
+	ShutdownReason     string    `json:"shutdownReason,omitempty"`
+}
+
+// deadline returns the time by which the event must be handled, or zero if the event has none.
+func (r *NextEventResponse) deadline() time.Time {
+	if r.DeadlineMs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, r.DeadlineMs*int64(time.Millisecond))
 }
 
 // Tracing is part of the response for /event/next
@@ -42,6 +54,46 @@ type StatusResponse struct {
 	Status string `json:"status"`
 }
 
+// ErrorResponse is the body of an error response from the Extensions API
+type ErrorResponse struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorType    string `json:"errorType"`
+}
+
+// APIError is returned when the Extensions API responds with a non-200 status
+type APIError struct {
+	StatusCode int
+	Status     string
+	ErrorResponse
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorType != "" {
+		return fmt.Sprintf("request failed with status %s: %s: %s", e.Status, e.ErrorType, e.ErrorMessage)
+	}
+	return fmt.Sprintf("request failed with status %s", e.Status)
+}
+
+// InvalidExtensionID returns true if the Extensions API rejected the request because it did not
+// recognize the extension identifier, e.g. because the execution environment was reset. Other
+// errors that the API reports with a 403 status are not treated as an invalid identifier.
+func (e *APIError) InvalidExtensionID() bool {
+	return e.StatusCode == http.StatusForbidden && e.ErrorType == invalidIDErrorType
+}
+
+func newAPIError(httpRes *http.Response) *APIError {
+	defer httpRes.Body.Close()
+	apiErr := APIError{
+		StatusCode: httpRes.StatusCode,
+		Status:     httpRes.Status,
+	}
+	// the body is informational only, so it's fine if it can't be read
+	if body, err := ioutil.ReadAll(httpRes.Body); err == nil {
+		_ = json.Unmarshal(body, &apiErr.ErrorResponse)
+	}
+	return &apiErr
+}
+
 // EventType represents the type of events recieved from /event/next
 type EventType string
 
@@ -52,9 +104,18 @@ const (
 	// Shutdown is a shutdown event for the environment
 	Shutdown EventType = "SHUTDOWN"
 
+	// FailureShutdownReason is the shutdown reason when the runtime of the function crashed
+	FailureShutdownReason = "failure"
+	// TimeoutShutdownReason is the shutdown reason when an invoke of the function timed out
+	TimeoutShutdownReason = "timeout"
+
 	extensionNameHeader      = "Lambda-Extension-Name"
 	extensionIdentiferHeader = "Lambda-Extension-Identifier"
 	extensionErrorType       = "Lambda-Extension-Function-Error-Type"
+	extensionAcceptFeature   = "Lambda-Extension-Accept-Feature"
+
+	// accountIDFeature asks the Extensions API to include the account ID in the register response
+	accountIDFeature = "accountId"
 )
 
 // Client is a simple client for the Lambda Extensions API
@@ -64,22 +125,29 @@ type Client struct {
 	extensionID string
 }
 
-// NewClient returns a Lambda Extensions API client
+// NewClient returns a Lambda Extensions API client. The Extensions API is local to the execution
+// environment, so the client never uses the proxy from the HTTP_PROXY environment variables.
 func NewClient(awsLambdaRuntimeAPI string) *Client {
 	baseURL := fmt.Sprintf("http://%s/2020-01-01/extension", awsLambdaRuntimeAPI)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
 	return &Client{
 		baseURL:    baseURL,
-		httpClient: &http.Client{},
+		httpClient: &http.Client{Transport: transport},
 	}
 }
 
-// Register will register the extension with the Extensions API
-func (e *Client) Register(ctx context.Context, filename string) (*RegisterResponse, error) {
+// Register will register the extension with the Extensions API. The extension will receive
+// the given events, or both invoke and shutdown events if none are given.
+func (e *Client) Register(ctx context.Context, filename string, events ...EventType) (*RegisterResponse, error) {
 	const action = "/register"
 	url := e.baseURL + action
 
+	if len(events) == 0 {
+		events = []EventType{Invoke, Shutdown}
+	}
 	reqBody, err := json.Marshal(map[string]interface{}{
-		"events": []EventType{Invoke, Shutdown},
+		"events": events,
 	})
 	if err != nil {
 		return nil, err
@@ -89,12 +157,13 @@ func (e *Client) Register(ctx context.Context, filename string) (*RegisterRespon
 		return nil, err
 	}
 	httpReq.Header.Set(extensionNameHeader, filename)
+	httpReq.Header.Set(extensionAcceptFeature, accountIDFeature)
 	httpRes, err := e.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed with status %s", httpRes.Status)
+		return nil, newAPIError(httpRes)
 	}
 	defer httpRes.Body.Close()
 	body, err := ioutil.ReadAll(httpRes.Body)
@@ -125,7 +194,7 @@ func (e *Client) NextEvent(ctx context.Context) (*NextEventResponse, error) {
 		return nil, err
 	}
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed with status %s", httpRes.Status)
+		return nil, newAPIError(httpRes)
 	}
 	defer httpRes.Body.Close()
 	body, err := ioutil.ReadAll(httpRes.Body)
@@ -156,7 +225,7 @@ func (e *Client) InitError(ctx context.Context, errorType string) (*StatusRespon
 		return nil, err
 	}
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed with status %s", httpRes.Status)
+		return nil, newAPIError(httpRes)
 	}
 	defer httpRes.Body.Close()
 	body, err := ioutil.ReadAll(httpRes.Body)
@@ -187,7 +256,7 @@ func (e *Client) ExitError(ctx context.Context, errorType string) (*StatusRespon
 		return nil, err
 	}
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed with status %s", httpRes.Status)
+		return nil, newAPIError(httpRes)
 	}
 	defer httpRes.Body.Close()
 	body, err := ioutil.ReadAll(httpRes.Body)
@@ -0,0 +1,80 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{
+      "errorMessage": "Invalid extension identifier",
+      "errorType": "Extension.InvalidExtensionID"
+    }`)
+	}))
+	defer server.Close()
+
+	// strip http:// prefix
+	client := NewClient(server.URL[7:])
+	_, err := client.NextEvent(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+	if !apiErr.InvalidExtensionID() {
+		t.Fatalf("Expected the error to indicate an invalid extension identifier, got %v", apiErr)
+	}
+	if apiErr.ErrorType != "Extension.InvalidExtensionID" {
+		t.Fatalf("Expected error type 'Extension.InvalidExtensionID', got %q", apiErr.ErrorType)
+	}
+}
+
+func TestAPIErrorInvalidExtensionID(t *testing.T) {
+	tests := []struct {
+		err      APIError
+		expected bool
+	}{
+		{APIError{StatusCode: http.StatusForbidden, ErrorResponse: ErrorResponse{ErrorType: "Extension.InvalidExtensionID"}}, true},
+		{APIError{StatusCode: http.StatusForbidden, ErrorResponse: ErrorResponse{ErrorType: "Extension.AccessDenied"}}, false},
+		{APIError{StatusCode: http.StatusForbidden}, false},
+		{APIError{StatusCode: http.StatusBadRequest, ErrorResponse: ErrorResponse{ErrorType: "Extension.InvalidExtensionID"}}, false},
+	}
+	for _, tc := range tests {
+		if got := tc.err.InvalidExtensionID(); got != tc.expected {
+			t.Errorf("Expected InvalidExtensionID() to return %v for %v, got %v", tc.expected, tc.err, got)
+		}
+	}
+}
+
+func TestClientRegisterAccountID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Lambda-Extension-Accept-Feature") != "accountId" {
+			t.Errorf("Expected the accountId feature to be accepted, got %q", r.Header.Get("Lambda-Extension-Accept-Feature"))
+		}
+		w.Header().Set(extensionIdentiferHeader, "id")
+		fmt.Fprintf(w, `{
+      "functionName": "foo",
+      "functionVersion": "1",
+      "handler": "bar",
+      "accountId": "123456789012"
+    }`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL[7:])
+	res, err := client.Register(context.Background(), "opa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.AccountID != "123456789012" {
+		t.Fatalf("Expected account ID '123456789012', got %q", res.AccountID)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Time bases
+const (
+	// WallTimeBasis measures intervals in wall-clock time, including the time the execution
+	// environment spent frozen.
+	WallTimeBasis = "wall"
+	// WarmTimeBasis measures intervals in warm time, i.e. the time from every event until the
+	// next one, capped at the deadline of the event. An interval then covers the same amount of
+	// work after a freeze as before.
+	WarmTimeBasis = "warm"
+)
+
+func validateTimeBasis(basis string) error {
+	switch basis {
+	case WallTimeBasis, WarmTimeBasis:
+		return nil
+	default:
+		return fmt.Errorf("invalid time basis %q, must be %q or %q", basis, WallTimeBasis, WarmTimeBasis)
+	}
+}
+
+// freezeAwareClock tracks warm time alongside wall time. Lambda freezes the execution environment
+// once the function has handled an invoke and the extension has asked for the next event, so from
+// inside the environment a freeze looks like a long wait for the next event. Warm time runs from
+// every event until the next one, but no further than the deadline of the event, after which the
+// environment must have been frozen. Before the first event, it runs until the extension first
+// asks for one.
+type freezeAwareClock struct {
+	mtx   sync.Mutex
+	start time.Time
+	// warm time up to the last event
+	warmed time.Duration
+	// when the last event was received, or when the clock was created
+	since time.Time
+	// when warm time stops, zero if it hasn't been determined yet
+	until time.Time
+}
+
+func newFreezeAwareClock(now time.Time) *freezeAwareClock {
+	return &freezeAwareClock{start: now, since: now}
+}
+
+// waiting is called when the extension asks for the next event. Unless warm time already stops at
+// the deadline of the last event, it stops now.
+func (c *freezeAwareClock) waiting(now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.until.IsZero() {
+		c.until = now
+	}
+}
+
+// event is called when the extension receives an event with the given deadline, which is zero if
+// the event has none.
+func (c *freezeAwareClock) event(now, deadline time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.warmed += c.elapsed(now)
+	c.since = now
+	c.until = deadline
+}
+
+// elapsed returns the warm time elapsed since the last event. The caller must hold the lock.
+func (c *freezeAwareClock) elapsed(now time.Time) time.Duration {
+	end := now
+	if !c.until.IsZero() && c.until.Before(end) {
+		end = c.until
+	}
+	if end.Before(c.since) {
+		return 0
+	}
+	return end.Sub(c.since)
+}
+
+// warm returns the warm time elapsed since the clock was created.
+func (c *freezeAwareClock) warm(now time.Time) time.Duration {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.warmed + c.elapsed(now)
+}
+
+// now returns the current time in the given time basis. Warm time is expressed as the time the
+// clock was created plus the warm time elapsed since then, so that it can be used wherever a
+// time.Time is expected.
+func (c *freezeAwareClock) now(basis string, now time.Time) time.Time {
+	if basis == WarmTimeBasis {
+		return c.start.Add(c.warm(now))
+	}
+	return now
+}
+
+// pluginTime returns the current time in the time basis of a plugin's trigger, which is the time
+// basis of the plugin in triggers, or the top level time basis.
+func (p *Plugin) pluginTime(pluginName string, now time.Time) time.Time {
+	basis := *p.config.TimeBasis
+	if trigger, ok := p.config.Triggers[pluginName]; ok {
+		basis = *trigger.TimeBasis
+	}
+	return p.clock.now(basis, now)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreezeAwareClockExcludesFreezes(t *testing.T) {
+	start := time.Now()
+	c := newFreezeAwareClock(start)
+	// init takes 2s, then the extension waits for the first invoke
+	c.waiting(start.Add(2 * time.Second))
+	// the invoke has a deadline of 5s, and the extension asks for the next event after 1s, while
+	// the function keeps running
+	invoked := start.Add(10 * time.Minute)
+	c.event(invoked, invoked.Add(5*time.Second))
+	c.waiting(invoked.Add(time.Second))
+	if got := c.warm(invoked.Add(3 * time.Second)); got != 5*time.Second {
+		t.Fatalf("Expected 5s of warm time while the function runs, got %v", got)
+	}
+
+	// frozen after the deadline, warm time stops at the deadline
+	now := start.Add(time.Hour)
+	if got := c.warm(now); got != 7*time.Second {
+		t.Fatalf("Expected 7s of warm time, got %v", got)
+	}
+	if got := c.now(WarmTimeBasis, now); !got.Equal(start.Add(7 * time.Second)) {
+		t.Fatalf("Expected warm time %v, got %v", start.Add(7*time.Second), got)
+	}
+	if got := c.now(WallTimeBasis, now); !got.Equal(now) {
+		t.Fatalf("Expected wall time %v, got %v", now, got)
+	}
+
+	// the next invoke arrives before the deadline of the previous one
+	c.event(now, now.Add(5*time.Second))
+	c.event(now.Add(time.Second), time.Time{})
+	c.waiting(now.Add(2 * time.Second))
+	if got := c.warm(now.Add(time.Hour)); got != 9*time.Second {
+		t.Fatalf("Expected 9s of warm time, got %v", got)
+	}
+}
+
+func TestIntervalTriggerStrategyWarmTime(t *testing.T) {
+	start := time.Now()
+	c := newFreezeAwareClock(start)
+	s := &intervalTriggerStrategy{threshold: 30 * time.Second}
+	if !s.ShouldTrigger(c.now(WarmTimeBasis, start)) {
+		t.Fatal("Expected the first invoke to trigger")
+	}
+	// a long freeze doesn't count towards the threshold
+	c.waiting(start.Add(time.Second))
+	c.event(start.Add(time.Hour), start.Add(time.Hour+3*time.Second))
+	if s.ShouldTrigger(c.now(WarmTimeBasis, start.Add(time.Hour+time.Second))) {
+		t.Fatal("Expected the invoke after a freeze not to trigger")
+	}
+}
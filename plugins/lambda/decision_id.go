@@ -0,0 +1,59 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// decisionIDFactory generates decision IDs from the request ID of the current lambda invoke and
+// a counter that restarts on every invoke, e.g. the second decision made while handling request
+// "8476a536-e9f4-11e8-9739-2dfe598c3fcd" is "8476a536-e9f4-11e8-9739-2dfe598c3fcd-2". A decision
+// can then be found from the request ID in CloudWatch, and vice versa.
+type decisionIDFactory struct {
+	mtx       sync.Mutex
+	requestID string
+	count     int
+}
+
+// invoke records the request ID of a new invoke.
+func (f *decisionIDFactory) invoke(requestID string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.requestID = requestID
+	f.count = 0
+}
+
+// current returns the request ID of the current invoke, or "" before the first invoke.
+func (f *decisionIDFactory) current() string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.requestID
+}
+
+// next returns the ID for the next decision. Decisions made before the first invoke, e.g. while
+// the function is initializing, get a random ID because there is no request ID to derive from.
+func (f *decisionIDFactory) next() string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.requestID == "" {
+		return randomUUID()
+	}
+	f.count++
+	return fmt.Sprintf("%s-%d", f.requestID, f.count)
+}
+
+// randomUUID returns a version 4 UUID, like the decision IDs generated by OPA by default. Like
+// OPA, it returns an empty ID if there isn't enough randomness available.
+func randomUUID() string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return ""
+	}
+	bs[6] = (bs[6] & 0x0f) | 0x40
+	bs[8] = (bs[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:])
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDecisionIDFactory(t *testing.T) {
+	f := decisionIDFactory{}
+
+	// there's no request ID before the first invoke, so the ID is random
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if id := f.next(); !uuid.MatchString(id) {
+		t.Fatalf("Expected a random UUID before the first invoke, got %q", id)
+	}
+
+	f.invoke("foo")
+	for _, expected := range []string{"foo-1", "foo-2"} {
+		if id := f.next(); id != expected {
+			t.Fatalf("Expected %q, got %q", expected, id)
+		}
+	}
+
+	// the counter restarts for every invoke
+	f.invoke("bar")
+	if id := f.next(); id != "bar-1" {
+		t.Fatalf("Expected %q, got %q", "bar-1", id)
+	}
+}
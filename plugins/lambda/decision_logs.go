@@ -0,0 +1,33 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build !minimal
+// +build !minimal
+
+package lambda
+
+import (
+	"context"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins/logs"
+	"github.com/open-policy-agent/opa/server"
+)
+
+// logInvokeFailed logs a decision log event that marks the failed invoke, if the decision_logs
+// plugin is enabled.
+func (p *Plugin) logInvokeFailed(ctx context.Context, requestID, annotation string) error {
+	plugin, ok := p.manager.Plugin(logs.Name).(*logs.Plugin)
+	if !ok {
+		return nil
+	}
+	var input interface{} = map[string]interface{}{"request_id": requestID, "sandbox_id": p.sandbox.id}
+	var result interface{} = map[string]interface{}{annotation: true}
+	return plugin.Log(ctx, &server.Info{
+		DecisionID: p.decisionIDs.next(),
+		Path:       invokeFailedPath,
+		Timestamp:  time.Now().UTC(),
+		Input:      &input,
+		Results:    &result,
+	})
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build minimal
+// +build minimal
+
+package lambda
+
+import (
+	"context"
+)
+
+// logInvokeFailed does nothing in minimal builds, which leave out the decision_logs plugin.
+func (p *Plugin) logInvokeFailed(context.Context, string, string) error {
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	goruntime "runtime"
+	"sync"
+	"time"
+
+	"github.com/godaddy/opa-lambda-extension-plugin/profiles"
+
+	"github.com/open-policy-agent/opa/logging"
+	"github.com/open-policy-agent/opa/plugins"
+)
+
+const recentErrorsSize = 20
+
+// writeBuildInfo writes the build info as a JSON record, e.g. to stdout, which goes to the log
+// group of the function whatever the log level, so fleet audits can query it with CloudWatch Logs
+// Insights.
+func writeBuildInfo(out io.Writer) error {
+	return json.NewEncoder(out).Encode(map[string]interface{}{"build_info": profiles.Build()})
+}
+
+// Dump is a diagnostic snapshot of the plugin. Debugging an extension that is stuck in a frozen
+// execution environment often has to be done from logs alone, so the dump collects everything
+// that could explain what the extension is doing.
+type Dump struct {
+	Time         time.Time                `json:"time"`
+	SandboxID    string                   `json:"sandbox_id"`
+	Build        profiles.BuildInfo       `json:"build"`
+	Config       Config                   `json:"config"`
+	PluginStates map[string]plugins.State `json:"plugin_states"`
+	Metrics      map[string]interface{}   `json:"metrics"`
+	RecentErrors []string                 `json:"recent_errors"`
+	Journal      []JournalEntry           `json:"journal,omitempty"`
+	Breakers     map[string]string        `json:"circuit_breakers,omitempty"`
+	Goroutines   string                   `json:"goroutines"`
+}
+
+// Dump returns a diagnostic snapshot of the plugin.
+func (p *Plugin) Dump() *Dump {
+	return &Dump{
+		Time:         time.Now(),
+		SandboxID:    p.sandbox.id,
+		Build:        profiles.Build(),
+		Config:       p.config,
+		PluginStates: p.pluginStates(),
+		Metrics:      p.metrics.All(),
+		RecentErrors: p.recentErrors.all(),
+		Journal:      p.journal.all(),
+		Breakers:     p.breakers.states(),
+		Goroutines:   goroutineStacks(),
+	}
+}
+
+func (p *Plugin) pluginStates() map[string]plugins.State {
+	states := map[string]plugins.State{}
+	for name, status := range p.manager.PluginStatus() {
+		if status != nil {
+			states[name] = status.State
+		}
+	}
+	return states
+}
+
+// logDump writes a diagnostic snapshot to the logs.
+func (p *Plugin) logDump() {
+	bs, err := json.Marshal(p.Dump())
+	if err != nil {
+		p.logger.Error("Failed to create diagnostic dump, %v", err)
+		return
+	}
+	p.logger.Info("Diagnostic dump: %s", bs)
+}
+
+// startDiagnostics starts the diagnostics listener, if an address is configured, and the handler
+// that logs a diagnostic dump when the process receives SIGUSR1.
+func (p *Plugin) startDiagnostics() error {
+	p.stopDumpSignal = notifyDumpSignal(p.logDump)
+	if *p.config.DiagnosticsAddr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", *p.config.DiagnosticsAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start diagnostics listener, %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/dump", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p.Dump()); err != nil {
+			p.logger.Error("Failed to write diagnostic dump, %v", err)
+		}
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(profiles.Build()); err != nil {
+			p.logger.Error("Failed to write build info, %v", err)
+		}
+	})
+	if *p.config.EnablePprof {
+		registerPprof(mux)
+	}
+	p.diagnosticsServer = &http.Server{Handler: mux}
+	go func() {
+		if err := p.diagnosticsServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			p.logger.Error("Diagnostics listener failed, %v", err)
+		}
+	}()
+	p.logger.Info("Diagnostics listening on %s.", listener.Addr())
+	return nil
+}
+
+func (p *Plugin) stopDiagnostics(ctx context.Context) {
+	if p.stopDumpSignal != nil {
+		p.stopDumpSignal()
+	}
+	if p.diagnosticsServer != nil {
+		if err := p.diagnosticsServer.Shutdown(ctx); err != nil {
+			p.logger.Error("Failed to stop diagnostics listener, %v", err)
+		}
+	}
+}
+
+func goroutineStacks() string {
+	stack := make([]byte, 1<<20)
+	return string(stack[:goruntime.Stack(stack, true)])
+}
+
+// recentErrors keeps the last few error messages that were logged by the plugin.
+type recentErrors struct {
+	mtx    sync.Mutex
+	errors []string
+	next   int
+}
+
+func newRecentErrors(size int) *recentErrors {
+	return &recentErrors{errors: make([]string, 0, size)}
+}
+
+func (r *recentErrors) add(msg string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if len(r.errors) < cap(r.errors) {
+		r.errors = append(r.errors, msg)
+		return
+	}
+	r.errors[r.next] = msg
+	r.next = (r.next + 1) % len(r.errors)
+}
+
+// all returns the recorded errors from oldest to newest.
+func (r *recentErrors) all() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append(append([]string{}, r.errors[r.next:]...), r.errors[:r.next]...)
+}
+
+// errorRecordingLogger is a logger that records the errors it logs, in memory and in the journal.
+type errorRecordingLogger struct {
+	logging.Logger
+	errors  *recentErrors
+	journal *journal
+}
+
+func (l *errorRecordingLogger) Error(f string, a ...interface{}) {
+	msg := fmt.Sprintf(f, a...)
+	l.errors.add(time.Now().Format(time.RFC3339) + " " + msg)
+	// a failure to write the journal can't be logged as an error without recursing
+	_ = l.journal.record(journalError, msg)
+	l.Logger.Error(f, a...)
+}
+
+func (l *errorRecordingLogger) WithFields(fields map[string]interface{}) logging.Logger {
+	return &errorRecordingLogger{Logger: l.Logger.WithFields(fields), errors: l.errors, journal: l.journal}
+}
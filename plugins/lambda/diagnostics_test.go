@@ -0,0 +1,115 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/godaddy/opa-lambda-extension-plugin/profiles"
+)
+
+func TestRecentErrors(t *testing.T) {
+	r := newRecentErrors(3)
+	if errs := r.all(); len(errs) != 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+	r.add("a")
+	r.add("b")
+	if errs := r.all(); !reflect.DeepEqual(errs, []string{"a", "b"}) {
+		t.Fatalf("Expected [a b], got %v", errs)
+	}
+	// the oldest errors are dropped once the buffer is full
+	r.add("c")
+	r.add("d")
+	r.add("e")
+	if errs := r.all(); !reflect.DeepEqual(errs, []string{"c", "d", "e"}) {
+		t.Fatalf("Expected [c d e], got %v", errs)
+	}
+}
+
+func TestDiagnosticsVersion(t *testing.T) {
+	p := newTestPlugin(t, `{"diagnostics_addr": "127.0.0.1:0"}`)
+	if err := p.startDiagnostics(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.stopDiagnostics(context.Background())
+
+	rec := httptest.NewRecorder()
+	p.diagnosticsServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var build profiles.BuildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&build); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(build, profiles.Build()) {
+		t.Fatalf("Expected %v, got %v", profiles.Build(), build)
+	}
+}
+
+func TestWriteBuildInfo(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeBuildInfo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var record struct {
+		BuildInfo profiles.BuildInfo `json:"build_info"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(record.BuildInfo, profiles.Build()) {
+		t.Fatalf("Expected %v, got %v", profiles.Build(), record.BuildInfo)
+	}
+}
+
+func TestDiagnosticsFailureFailsInit(t *testing.T) {
+	initErrors := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-01-01/extension/register":
+			w.Header().Set(extensionIdentiferHeader, "id")
+			fmt.Fprintf(w, `{"functionName": "foo", "functionVersion": "1", "handler": "bar"}`)
+		case "/2020-01-01/extension/init/error":
+			initErrors = append(initErrors, r.Header.Get(extensionErrorType))
+			fmt.Fprintf(w, `{"status": "OK"}`)
+		default:
+			t.Errorf("unexpected path sent to test server: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	// the diagnostics listener can't listen on an address that is already in use
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	p := newTestPlugin(t, fmt.Sprintf(`{"diagnostics_addr": %q}`, listener.Addr().String()))
+	p.client = NewClient(server.URL[7:])
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	if err := p.Start(context.Background()); err == nil {
+		t.Fatal("Expected Start to fail")
+	}
+	if p.stopDumpSignal != nil {
+		p.stopDumpSignal()
+	}
+
+	if code != 1 {
+		t.Fatalf("Expected the extension to exit with code 1, got %d", code)
+	}
+	if !reflect.DeepEqual(initErrors, []string{diagnosticsErrorType}) {
+		t.Fatalf("Expected a single %s init error, got %v", diagnosticsErrorType, initErrors)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins/bundle"
+)
+
+// EMF units
+const (
+	emfCount        = "Count"
+	emfSeconds      = "Seconds"
+	emfMilliseconds = "Milliseconds"
+	emfBytes        = "Bytes"
+)
+
+// emfMetric is a metric in a CloudWatch embedded metric format record.
+type emfMetric struct {
+	name  string
+	unit  string
+	value float64
+}
+
+// emfWriter writes CloudWatch embedded metric format (EMF) records. The stdout of an extension
+// goes to the log group of the function, where CloudWatch extracts the metrics from the records,
+// so custom metrics don't need the CloudWatch API or any permissions. A nil emfWriter writes
+// nothing.
+type emfWriter struct {
+	mtx       sync.Mutex
+	out       io.Writer
+	namespace string
+	sandbox   string
+}
+
+func newEMFWriter(namespace, sandbox string) *emfWriter {
+	if namespace == "" {
+		return nil
+	}
+	return &emfWriter{out: os.Stdout, namespace: namespace, sandbox: sandbox}
+}
+
+// write writes a record with the metrics, using all the dimensions as a single dimension set. The
+// record also identifies the sandbox, as a property rather than a dimension, so it can be queried
+// in CloudWatch Logs Insights without creating a metric per sandbox.
+func (w *emfWriter) write(dimensions map[string]string, metrics []emfMetric) error {
+	if w == nil {
+		return nil
+	}
+	names := make([]string, 0, len(dimensions))
+	for name := range dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	definitions := make([]map[string]string, 0, len(metrics))
+	for _, m := range metrics {
+		definitions = append(definitions, map[string]string{"Name": m.name, "Unit": m.unit})
+	}
+	record := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  w.namespace,
+				"Dimensions": [][]string{names},
+				"Metrics":    definitions,
+			}},
+		},
+		"SandboxID": w.sandbox,
+	}
+	for name, value := range dimensions {
+		record[name] = value
+	}
+	for _, m := range metrics {
+		record[m.name] = m.value
+	}
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	_, err = w.out.Write(append(bs, '\n'))
+	return err
+}
+
+// functionDimensions returns the dimensions that identify the function.
+func functionDimensions() map[string]string {
+	return map[string]string{"FunctionName": os.Getenv("AWS_LAMBDA_FUNCTION_NAME")}
+}
+
+// registerBundleListener registers a listener for bundle status updates with the bundle plugin,
+// if bundle metrics, the staleness monitor, or a revision pin are enabled, once the bundle plugin
+// exists. With discovery, the bundle plugin is only created once the discovery bundle has been
+// downloaded, so this is called again before every round of triggers.
+func (p *Plugin) registerBundleListener() {
+	if (p.emf == nil && *p.config.BundleStalenessSLA <= 0 && p.revisionPin == nil) || p.bundleListenerRegistered {
+		return
+	}
+	plugin := bundle.Lookup(p.manager)
+	if plugin == nil {
+		return
+	}
+	plugin.Register(Name, p.bundleStatusUpdated)
+	p.bundleListenerRegistered = true
+}
+
+// bundleStatusUpdated emits the status of a bundle as metrics, and updates the staleness monitor
+// and the revision pin, every time the bundle plugin has tried to download it.
+func (p *Plugin) bundleStatusUpdated(status bundle.Status) {
+	p.staleness.update(status)
+	if err := p.revisionPin.update(status); err != nil {
+		p.logger.Error("Revision pin violated, %v", err)
+		p.reportExitError(context.Background(), revisionPinErrorType)
+		exit(1)
+		return
+	}
+	if p.emf == nil {
+		return
+	}
+	now := time.Now()
+	success, failure := 1.0, 0.0
+	if status.Code != "" || len(status.Errors) > 0 {
+		success, failure = 0, 1
+	}
+	metrics := []emfMetric{
+		{name: "BundleActivationSuccess", unit: emfCount, value: success},
+		{name: "BundleActivationFailure", unit: emfCount, value: failure},
+	}
+	// the ages are left out until the first success, rather than reported as decades
+	if !status.LastSuccessfulDownload.IsZero() {
+		metrics = append(metrics, emfMetric{name: "BundleLastSuccessfulDownloadAge", unit: emfSeconds, value: now.Sub(status.LastSuccessfulDownload).Seconds()})
+	}
+	if !status.LastSuccessfulRequest.IsZero() {
+		metrics = append(metrics, emfMetric{name: "BundleLastSuccessfulRequestAge", unit: emfSeconds, value: now.Sub(status.LastSuccessfulRequest).Seconds()})
+	}
+	dimensions := functionDimensions()
+	dimensions["Bundle"] = status.Name
+	if err := p.emf.write(dimensions, metrics); err != nil {
+		p.logger.Warn("Failed to write bundle metrics, %v", err)
+	}
+}
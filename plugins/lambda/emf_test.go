@@ -0,0 +1,84 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins/bundle"
+)
+
+func TestBundleStatusMetrics(t *testing.T) {
+	os.Setenv("AWS_LAMBDA_FUNCTION_NAME", "foo")
+	defer os.Unsetenv("AWS_LAMBDA_FUNCTION_NAME")
+	p := newTestPlugin(t, `{"emf_namespace": "OPA"}`)
+	var out bytes.Buffer
+	p.emf.out = &out
+
+	status := bundle.Status{Name: "authz", LastSuccessfulDownload: time.Now().Add(-time.Minute)}
+	status.SetError(errors.New("download failed"))
+	p.bundleStatusUpdated(status)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["FunctionName"] != "foo" || record["Bundle"] != "authz" {
+		t.Fatalf("Expected the function and bundle dimensions, got %v", record)
+	}
+	if record["BundleActivationSuccess"] != 0.0 || record["BundleActivationFailure"] != 1.0 {
+		t.Fatalf("Expected a failed activation, got %v", record)
+	}
+	if age, ok := record["BundleLastSuccessfulDownloadAge"].(float64); !ok || age < 60 {
+		t.Fatalf("Expected a download age of at least 60s, got %v", record["BundleLastSuccessfulDownloadAge"])
+	}
+	if _, ok := record["BundleLastSuccessfulRequestAge"]; ok {
+		t.Fatal("Expected no request age before the first successful request")
+	}
+	directive := record["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+	if directive["Namespace"] != "OPA" {
+		t.Fatalf("Expected namespace OPA, got %v", directive["Namespace"])
+	}
+	if dimensions := directive["Dimensions"]; !reflect.DeepEqual(dimensions, []interface{}{[]interface{}{"Bundle", "FunctionName"}}) {
+		t.Fatalf("Expected the Bundle and FunctionName dimensions, got %v", dimensions)
+	}
+}
+
+func TestEMFDisabled(t *testing.T) {
+	if w := newEMFWriter("", ""); w != nil {
+		t.Fatalf("Expected no EMF writer, got %v", w)
+	}
+}
+
+func TestInvokeUsageMetrics(t *testing.T) {
+	p := newTestPlugin(t, `{"emf_namespace": "OPA", "emf_invoke_metrics": true}`)
+	var out bytes.Buffer
+	p.emf.out = &out
+	p.lastUsage = readResourceUsage()
+	if len(bytes.Repeat([]byte("a"), 1<<20)) == 0 {
+		t.Fatal("Expected an allocation")
+	}
+
+	p.emitInvokeUsage(5 * time.Millisecond)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["ExtensionInvokeOverhead"] != 5.0 {
+		t.Fatalf("Expected an overhead of 5ms, got %v", record["ExtensionInvokeOverhead"])
+	}
+	if allocated, ok := record["ExtensionAllocatedBytes"].(float64); !ok || allocated <= 0 {
+		t.Fatalf("Expected allocated bytes, got %v", record["ExtensionAllocatedBytes"])
+	}
+	if _, ok := record["ExtensionCPUTime"].(float64); !ok {
+		t.Fatalf("Expected the CPU time, got %v", record["ExtensionCPUTime"])
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+var errInjectedFault = errors.New("injected fault")
+
+// FaultInjectionConfig represents the faults that are injected to test how the function behaves
+// when the extension or the services it talks to misbehave. It must never be set in production.
+type FaultInjectionConfig struct {
+	// Faults injected into the triggers of plugins, keyed by plugin name.
+	Plugins map[string]*PluginFaultConfig `json:"plugins,omitempty"`
+	// The time in milliseconds that the extension sleeps before handling the shutdown event, to
+	// simulate a shutdown that doesn't finish within the shutdown window.
+	ShutdownDelay *int `json:"shutdown_delay_ms,omitempty"`
+}
+
+// PluginFaultConfig represents the faults injected into the triggers of a plugin.
+type PluginFaultConfig struct {
+	// The percentage of triggers that fail without triggering the plugin, e.g. so decision logs
+	// aren't uploaded.
+	FailurePercent *int `json:"failure_percent,omitempty"`
+	// The time in milliseconds that every trigger is delayed, e.g. to simulate a slow bundle
+	// download. The delay counts against the trigger timeout.
+	Delay *int `json:"delay_ms,omitempty"`
+}
+
+func (c *FaultInjectionConfig) validate() error {
+	if c.ShutdownDelay == nil {
+		shutdownDelay := 0
+		c.ShutdownDelay = &shutdownDelay
+	} else if *c.ShutdownDelay < 0 {
+		return fmt.Errorf("shutdown_delay_ms must not be negative")
+	}
+	for pluginName, faults := range c.Plugins {
+		if faults == nil {
+			faults = &PluginFaultConfig{}
+			c.Plugins[pluginName] = faults
+		}
+		if faults.FailurePercent == nil {
+			failurePercent := 0
+			faults.FailurePercent = &failurePercent
+		} else if *faults.FailurePercent < 0 || *faults.FailurePercent > 100 {
+			return fmt.Errorf("failure_percent for plugin %q must be between 0 and 100", pluginName)
+		}
+		if faults.Delay == nil {
+			delay := 0
+			faults.Delay = &delay
+		} else if *faults.Delay < 0 {
+			return fmt.Errorf("delay_ms for plugin %q must not be negative", pluginName)
+		}
+	}
+	return nil
+}
+
+// injectTriggerFault delays the trigger of a plugin, and returns an error instead of letting the
+// plugin be triggered, as configured.
+func (p *Plugin) injectTriggerFault(ctx context.Context, pluginName string) error {
+	if p.config.FaultInjection == nil {
+		return nil
+	}
+	faults, ok := p.config.FaultInjection.Plugins[pluginName]
+	if !ok {
+		return nil
+	}
+	if delay := time.Duration(*faults.Delay) * time.Millisecond; delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	if rand.Intn(100) < *faults.FailurePercent {
+		return errInjectedFault
+	}
+	return nil
+}
+
+// injectShutdownDelay sleeps before the shutdown event is handled, as configured. The watchdog
+// and the Lambda service see the extension as stuck.
+func (p *Plugin) injectShutdownDelay() {
+	if p.config.FaultInjection == nil {
+		return
+	}
+	if delay := time.Duration(*p.config.FaultInjection.ShutdownDelay) * time.Millisecond; delay > 0 {
+		p.logger.Warn("Injecting a shutdown delay of %v.", delay)
+		time.Sleep(delay)
+	}
+}
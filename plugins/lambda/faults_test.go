@@ -0,0 +1,34 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestInjectTriggerFault(t *testing.T) {
+	p := newTestPlugin(t, `{"fault_injection": {"plugins": {"decision_logs": {"failure_percent": 100}, "bundle": {"delay_ms": 60000}}}}`)
+	ctx := context.Background()
+	if err := p.injectTriggerFault(ctx, "decision_logs"); !errors.Is(err, errInjectedFault) {
+		t.Fatalf("Expected an injected fault, got %v", err)
+	}
+	if err := p.injectTriggerFault(ctx, "status"); err != nil {
+		t.Fatalf("Expected no fault for a plugin without faults, got %v", err)
+	}
+	// the delay is cut short by the trigger timeout
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := p.injectTriggerFault(cancelled, "bundle"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the delay to be cancelled, got %v", err)
+	}
+}
+
+func TestInjectTriggerFaultDisabled(t *testing.T) {
+	p := newTestPlugin(t, `{}`)
+	if err := p.injectTriggerFault(context.Background(), "decision_logs"); err != nil {
+		t.Fatalf("Expected no fault, got %v", err)
+	}
+}
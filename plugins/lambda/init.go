@@ -0,0 +1,110 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// initTask is a unit of work done while the extension initializes.
+type initTask struct {
+	name string
+	// names of the tasks that must finish before this one starts. Dependencies on tasks that
+	// don't exist are ignored, e.g. the bundle plugin depends on discovery, but discovery may not
+	// be configured.
+	deps []string
+	run  func(ctx context.Context)
+}
+
+// runInitTasks runs the tasks concurrently, starting each task as soon as all of its dependencies
+// have finished, and returns when all of them have finished. The tasks share the deadline of the
+// context, so a chain of slow dependencies can't take longer than starting them one by one. Tasks
+// that are still waiting for their dependencies when the deadline passes don't run.
+func runInitTasks(ctx context.Context, tasks []initTask) error {
+	if err := checkInitTaskCycles(tasks); err != nil {
+		return err
+	}
+	done := make(map[string]chan struct{}, len(tasks))
+	for _, task := range tasks {
+		if _, ok := done[task.name]; ok {
+			return fmt.Errorf("duplicate task %q", task.name)
+		}
+		done[task.name] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task initTask) {
+			defer wg.Done()
+			defer close(done[task.name])
+			for _, dep := range task.deps {
+				if ch, ok := done[dep]; ok {
+					<-ch
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			task.run(ctx)
+		}(task)
+	}
+	wg.Wait()
+	return nil
+}
+
+// checkInitTaskCycles returns an error if the tasks could never finish because they depend on
+// each other.
+func checkInitTaskCycles(tasks []initTask) error {
+	deps := make(map[string][]string, len(tasks))
+	for _, task := range tasks {
+		deps[task.name] = task.deps
+	}
+	return checkDependencyCycles(deps)
+}
+
+// checkDuplicates returns an error if a name appears more than once.
+func checkDuplicates(names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("duplicate name %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// checkDependencyCycles returns an error if the dependency graph, keyed by name, contains a cycle.
+func checkDependencyCycles(deps map[string][]string) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %v", append(path, name))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range deps {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
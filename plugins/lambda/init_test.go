@@ -0,0 +1,97 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunInitTasks(t *testing.T) {
+	var mtx sync.Mutex
+	finished := []string{}
+	finish := func(name string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		finished = append(finished, name)
+	}
+	// bundle and decision_logs each wait for the other to start, so they only finish if they
+	// run in parallel
+	bundleStarted := make(chan struct{})
+	decisionLogsStarted := make(chan struct{})
+	parallel := func(name string, started, other chan struct{}) initTask {
+		return initTask{
+			name: name,
+			deps: []string{"discovery"},
+			run: func(ctx context.Context) {
+				close(started)
+				select {
+				case <-other:
+					finish(name)
+				case <-ctx.Done():
+					t.Errorf("Expected %s to run in parallel", name)
+				}
+			},
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := runInitTasks(ctx, []initTask{
+		{name: "status", deps: []string{"bundle", "decision_logs"}, run: func(ctx context.Context) { finish("status") }},
+		parallel("bundle", bundleStarted, decisionLogsStarted),
+		parallel("decision_logs", decisionLogsStarted, bundleStarted),
+		// discovery isn't one of the tasks, so the dependency on it is ignored
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(finished) != 3 || finished[2] != "status" {
+		t.Fatalf("Expected status to finish after its dependencies, got %v", finished)
+	}
+}
+
+func TestRunInitTasksDeadline(t *testing.T) {
+	ran := []string{}
+	ctx, cancel := context.WithCancel(context.Background())
+	err := runInitTasks(ctx, []initTask{
+		// bundle hangs until the context is done, as if it hit the deadline
+		{name: "bundle", run: func(ctx context.Context) {
+			ran = append(ran, "bundle")
+			cancel()
+			<-ctx.Done()
+		}},
+		{name: "status", deps: []string{"bundle"}, run: func(ctx context.Context) {
+			ran = append(ran, "status")
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ran, []string{"bundle"}) {
+		t.Fatalf("Expected only bundle to run before the deadline, got %v", ran)
+	}
+}
+
+func TestRunInitTasksCycle(t *testing.T) {
+	err := runInitTasks(context.Background(), []initTask{
+		{name: "foo", deps: []string{"bar"}, run: func(ctx context.Context) {}},
+		{name: "bar", deps: []string{"foo"}, run: func(ctx context.Context) {}},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a dependency cycle")
+	}
+}
+
+func TestRunInitTasksDuplicate(t *testing.T) {
+	err := runInitTasks(context.Background(), []initTask{
+		{name: "foo", run: func(ctx context.Context) {}},
+		{name: "foo", run: func(ctx context.Context) {}},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a duplicate task")
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Journal events
+const (
+	journalStart     = "start"
+	journalRegister  = "register"
+	journalReady     = "ready"
+	journalInvoke    = "invoke"
+	journalShutdown  = "shutdown"
+	journalError     = "error"
+	journalInitError = "init_error"
+	journalExitError = "exit_error"
+	journalDegraded  = "degraded"
+)
+
+// degradedRecoveryInvokes is the number of invokes that a degraded start that got ready has to
+// handle before the crash loop is considered over.
+const degradedRecoveryInvokes = 5
+
+// JournalEntry is a lifecycle event recorded in the journal.
+type JournalEntry struct {
+	Time    time.Time `json:"time"`
+	Sandbox string    `json:"sandbox,omitempty"`
+	Event   string    `json:"event"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// journal keeps the last few lifecycle events in a file, one JSON entry per line. Lambda can kill
+// the extension at any time, e.g. when it times out, so the file is rewritten after every event,
+// except for deferred events, which are written with the next event or by the journal_flush
+// maintenance task. The entries left by a previous process are read back when the extension
+// starts. A nil journal records nothing.
+type journal struct {
+	mtx     sync.Mutex
+	path    string
+	size    int
+	sandbox string
+	entries []JournalEntry
+	// true if there are deferred entries that haven't been written yet
+	pending bool
+}
+
+func newJournal(path string, size int, sandbox string) *journal {
+	if path == "" {
+		return nil
+	}
+	return &journal{path: path, size: size, sandbox: sandbox}
+}
+
+// load reads the entries left by a previous process, and returns them.
+func (j *journal) load() ([]JournalEntry, error) {
+	if j == nil {
+		return nil, nil
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	bs, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		var entry JournalEntry
+		// a partially written line is skipped, the other entries are still useful
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	j.entries = j.truncate(entries)
+	return append([]JournalEntry{}, j.entries...), nil
+}
+
+// record adds an event to the journal and writes the journal to its file.
+func (j *journal) record(event, detail string) error {
+	if j == nil {
+		return nil
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	j.add(event, detail)
+	return j.write()
+}
+
+// recordDeferred adds an event to the journal without writing the journal to its file, so the
+// event is lost if the extension is killed before the journal is written.
+func (j *journal) recordDeferred(event, detail string) {
+	if j == nil {
+		return
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	j.add(event, detail)
+	j.pending = true
+}
+
+// flush writes the journal to its file if it has deferred events that haven't been written. It's
+// the journal_flush maintenance task.
+func (j *journal) flush(ctx context.Context) error {
+	if j == nil {
+		return nil
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if !j.pending {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return j.write()
+}
+
+func (j *journal) add(event, detail string) {
+	j.entries = j.truncate(append(j.entries, JournalEntry{Time: time.Now(), Sandbox: j.sandbox, Event: event, Detail: detail}))
+}
+
+// write writes the entries to the journal file. The caller must hold the lock.
+func (j *journal) write() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range j.entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	// write to a temporary file first, so a process that is killed mid-write doesn't leave a
+	// truncated journal behind
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+	j.pending = false
+	return nil
+}
+
+// all returns the entries from oldest to newest.
+func (j *journal) all() []JournalEntry {
+	if j == nil {
+		return nil
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	return append([]JournalEntry{}, j.entries...)
+}
+
+func (j *journal) truncate(entries []JournalEntry) []JournalEntry {
+	if len(entries) > j.size {
+		return append([]JournalEntry{}, entries[len(entries)-j.size:]...)
+	}
+	return entries
+}
+
+// failedStarts returns the number of starts at the end of the journal that never got ready, i.e.
+// that were killed, crashed, or failed init. A degraded start that got ready only resets the count
+// once it has handled degradedRecoveryInvokes invokes, because it only got ready by skipping what
+// made the previous starts fail, so until it has shown that it can serve the function, the next
+// start stays degraded.
+func failedStarts(entries []JournalEntry) int {
+	failed := 0
+	degraded := false
+	// the invokes handled by a degraded start since it got ready, or -1 if it didn't get ready
+	degradedInvokes := -1
+	for _, entry := range entries {
+		switch entry.Event {
+		case journalStart:
+			failed++
+			degraded = false
+			degradedInvokes = -1
+		case journalDegraded:
+			degraded = true
+		case journalReady:
+			if !degraded {
+				failed = 0
+			} else {
+				degradedInvokes = 0
+			}
+		case journalInvoke:
+			if degradedInvokes < 0 {
+				continue
+			}
+			degradedInvokes++
+			if degradedInvokes >= degradedRecoveryInvokes {
+				failed = 0
+			}
+		}
+	}
+	return failed
+}
+
+// degradeAfterCrashLoop relaxes the configuration when the journal shows that the previous starts
+// kept failing init, so the function can serve requests instead of failing every cold start. The
+// policy tests are skipped, and the extension fails open instead of closed if init times out.
+func (p *Plugin) degradeAfterCrashLoop(previous []JournalEntry) {
+	threshold := *p.config.CrashLoopThreshold
+	failed := failedStarts(previous)
+	if threshold <= 0 || failed < threshold {
+		return
+	}
+	p.logger.Warn("The last %d starts failed to initialize, running degraded: skipping policy tests, failing open on init timeout.", failed)
+	// the config is shared with the manager, so the pointers are replaced rather than updated
+	runPolicyTests := false
+	p.config.RunPolicyTests = &runPolicyTests
+	if *p.config.InitTimeoutBehavior == FailClosedInitTimeoutBehavior {
+		initTimeoutBehavior := FailOpenInitTimeoutBehavior
+		p.config.InitTimeoutBehavior = &initTimeoutBehavior
+	}
+	p.recordJournal(journalDegraded, fmt.Sprintf("%d failed starts", failed))
+}
+
+// recordJournal adds an event to the journal, logging rather than returning any error because the
+// journal is only a debugging aid.
+func (p *Plugin) recordJournal(event, detail string) {
+	if err := p.journal.record(event, detail); err != nil {
+		p.logger.Warn("Failed to write journal, %v", err)
+	}
+}
+
+// recordInvokeJournal adds an invoke to the journal. With maintenance enabled, writing the journal
+// is deferred to the journal_flush maintenance task, so invokes don't wait for the file to be
+// rewritten.
+func (p *Plugin) recordInvokeJournal(requestID string) {
+	if p.maintenance == nil {
+		p.recordJournal(journalInvoke, requestID)
+		return
+	}
+	p.journal.recordDeferred(journalInvoke, requestID)
+}
+
+// logJournal writes the journal to the logs.
+func (p *Plugin) logJournal(msg string, entries []JournalEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	bs, err := json.Marshal(entries)
+	if err != nil {
+		p.logger.Warn("Failed to marshal journal, %v", err)
+		return
+	}
+	p.logger.Info("%s: %s", msg, bs)
+}
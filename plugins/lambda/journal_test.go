@@ -0,0 +1,163 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+func journalEvents(entries []JournalEntry) []string {
+	events := []string{}
+	for _, entry := range entries {
+		events = append(events, entry.Event+":"+entry.Detail)
+	}
+	return events
+}
+
+func TestJournalSurvivesRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	j := newJournal(path, 3, "sandbox")
+	if entries, err := j.load(); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected an empty journal, got %v, %v", entries, err)
+	}
+	for _, requestID := range []string{"a", "b", "c"} {
+		if err := j.record(journalInvoke, requestID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.record(journalExitError, watchdogErrorType); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest entries are dropped once the journal is full
+	entries, err := newJournal(path, 3, "sandbox").load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"invoke:b", "invoke:c", "exit_error:" + watchdogErrorType}
+	if got := journalEvents(entries); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestJournalDisabled(t *testing.T) {
+	j := newJournal("", 3, "sandbox")
+	if err := j.record(journalInvoke, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if entries := j.all(); len(entries) != 0 {
+		t.Fatalf("Expected no entries, got %v", entries)
+	}
+}
+
+func TestFailedStarts(t *testing.T) {
+	entries := []JournalEntry{
+		{Event: journalStart}, {Event: journalReady}, {Event: journalInvoke},
+		{Event: journalStart}, {Event: journalInitError},
+		{Event: journalStart}, {Event: journalRegister},
+	}
+	if failed := failedStarts(entries); failed != 2 {
+		t.Fatalf("Expected 2 failed starts, got %d", failed)
+	}
+	if failed := failedStarts(entries[:3]); failed != 0 {
+		t.Fatalf("Expected no failed starts, got %d", failed)
+	}
+	// a degraded start that got ready keeps the count, so the next start is degraded as well
+	entries = append(entries, JournalEntry{Event: journalStart}, JournalEntry{Event: journalDegraded}, JournalEntry{Event: journalReady})
+	if failed := failedStarts(entries); failed != 3 {
+		t.Fatalf("Expected 3 failed starts, got %d", failed)
+	}
+	for i := 0; i < degradedRecoveryInvokes-1; i++ {
+		entries = append(entries, JournalEntry{Event: journalInvoke})
+	}
+	if failed := failedStarts(entries); failed != 3 {
+		t.Fatalf("Expected 3 failed starts before the degraded start recovered, got %d", failed)
+	}
+	// the degraded start handled enough invokes, so the crash loop is over
+	entries = append(entries, JournalEntry{Event: journalInvoke})
+	if failed := failedStarts(entries); failed != 0 {
+		t.Fatalf("Expected no failed starts after the degraded start recovered, got %d", failed)
+	}
+}
+
+func TestFailedStartsDegradedWithoutReady(t *testing.T) {
+	// invokes handled while a degraded start fails open don't count towards the recovery
+	entries := []JournalEntry{{Event: journalStart}, {Event: journalStart}, {Event: journalStart}, {Event: journalDegraded}}
+	for i := 0; i < degradedRecoveryInvokes; i++ {
+		entries = append(entries, JournalEntry{Event: journalInvoke})
+	}
+	if failed := failedStarts(entries); failed != 3 {
+		t.Fatalf("Expected 3 failed starts, got %d", failed)
+	}
+}
+
+func TestCrashLoopRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	newPlugin := func() *Plugin {
+		p := newTestPlugin(t, fmt.Sprintf(`{"run_policy_tests": true, "crash_loop_threshold": 2, "journal_path": %q}`, path))
+		previous, err := p.journal.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.recordJournal(journalStart, "")
+		p.degradeAfterCrashLoop(previous)
+		return p
+	}
+	// two starts that never got ready
+	newPlugin()
+	newPlugin()
+	// the third start is degraded, gets ready, and handles invokes until the crash loop is over
+	p := newPlugin()
+	if *p.config.RunPolicyTests {
+		t.Fatal("Expected the start after the crash loop to be degraded")
+	}
+	p.recordJournal(journalReady, "")
+	for i := 0; i < degradedRecoveryInvokes; i++ {
+		p.recordJournal(journalInvoke, "")
+	}
+	if p = newPlugin(); !*p.config.RunPolicyTests {
+		t.Fatal("Expected the start after the recovery not to be degraded")
+	}
+}
+
+func TestDegradeAfterCrashLoop(t *testing.T) {
+	manager, err := plugins.New(nil, "test", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := PluginFactory{}
+	config, err := factory.Validate(manager, []byte(`{"run_policy_tests": true, "init_timeout": 5, "init_timeout_behavior": "fail_closed", "crash_loop_threshold": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := factory.New(manager, config).(*Plugin)
+
+	p.degradeAfterCrashLoop([]JournalEntry{{Event: journalStart}})
+	if !*p.config.RunPolicyTests {
+		t.Fatal("Expected a single failed start not to degrade the plugin")
+	}
+	p.degradeAfterCrashLoop([]JournalEntry{{Event: journalStart}, {Event: journalStart}})
+	if *p.config.RunPolicyTests || *p.config.InitTimeoutBehavior != FailOpenInitTimeoutBehavior {
+		t.Fatalf("Expected the plugin to be degraded, got run_policy_tests %v, init_timeout_behavior %s",
+			*p.config.RunPolicyTests, *p.config.InitTimeoutBehavior)
+	}
+	// the validated config isn't changed
+	if !*config.(*Config).RunPolicyTests {
+		t.Fatal("Expected the validated config not to change")
+	}
+}
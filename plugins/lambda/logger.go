@@ -0,0 +1,124 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Log levels of the plugin's own logger
+const (
+	DebugLogLevel = "debug"
+	InfoLogLevel  = "info"
+	WarnLogLevel  = "warn"
+	ErrorLogLevel = "error"
+)
+
+func parseLogLevel(level string) (logging.Level, error) {
+	switch level {
+	case DebugLogLevel:
+		return logging.Debug, nil
+	case InfoLogLevel:
+		return logging.Info, nil
+	case WarnLogLevel:
+		return logging.Warn, nil
+	case ErrorLogLevel:
+		return logging.Error, nil
+	}
+	return 0, fmt.Errorf("invalid log_level %q, must be %q, %q, %q, or %q", level, DebugLogLevel, InfoLogLevel, WarnLogLevel, ErrorLogLevel)
+}
+
+// newPluginLogger returns the logger that the plugin logs through. Without a log level, it's the
+// logger of the plugin manager. With a log level, it's a separate logger that writes JSON to
+// stderr at that level, so the plugin's debug logs can be enabled without enabling OPA's. With a
+// rate limit, messages below the error level that exceed it are dropped.
+func newPluginLogger(manager logging.Logger, level string, rateLimit int) logging.Logger {
+	logger := manager
+	if level != "" {
+		standard := logging.New()
+		standard.SetFormatter(&logrus.JSONFormatter{})
+		// the level was validated with the rest of the configuration
+		if l, err := parseLogLevel(level); err == nil {
+			standard.SetLevel(l)
+		}
+		logger = standard
+	}
+	if rateLimit > 0 {
+		logger = &rateLimitedLogger{Logger: logger, limiter: &logRateLimiter{limit: rateLimit}}
+	}
+	return logger
+}
+
+// logRateLimiter allows a number of messages per second.
+type logRateLimiter struct {
+	mtx     sync.Mutex
+	limit   int
+	window  time.Time
+	count   int
+	dropped int
+}
+
+// allow returns true if a message may be logged, and the number of messages dropped in the
+// previous windows if it's the first message of a window.
+func (r *logRateLimiter) allow(now time.Time) (bool, int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if now.Sub(r.window) >= time.Second {
+		r.window = now
+		r.count = 0
+	}
+	if r.count >= r.limit {
+		r.dropped++
+		return false, 0
+	}
+	r.count++
+	dropped := 0
+	if r.count == 1 {
+		dropped, r.dropped = r.dropped, 0
+	}
+	return true, dropped
+}
+
+// rateLimitedLogger drops debug, info, and warning messages that exceed the rate limit, so a
+// misbehaving plugin can't flood the logs of the function. Errors are always logged, and the
+// number of dropped messages is logged once messages are allowed again.
+type rateLimitedLogger struct {
+	logging.Logger
+	limiter *logRateLimiter
+}
+
+func (l *rateLimitedLogger) allow() bool {
+	ok, dropped := l.limiter.allow(time.Now())
+	if dropped > 0 {
+		l.Logger.Warn("Dropped %d log messages that exceeded the rate limit of %d per second.", dropped, l.limiter.limit)
+	}
+	return ok
+}
+
+func (l *rateLimitedLogger) Debug(f string, a ...interface{}) {
+	if l.GetLevel() >= logging.Debug && l.allow() {
+		l.Logger.Debug(f, a...)
+	}
+}
+
+func (l *rateLimitedLogger) Info(f string, a ...interface{}) {
+	if l.GetLevel() >= logging.Info && l.allow() {
+		l.Logger.Info(f, a...)
+	}
+}
+
+func (l *rateLimitedLogger) Warn(f string, a ...interface{}) {
+	if l.GetLevel() >= logging.Warn && l.allow() {
+		l.Logger.Warn(f, a...)
+	}
+}
+
+func (l *rateLimitedLogger) WithFields(fields map[string]interface{}) logging.Logger {
+	return &rateLimitedLogger{Logger: l.Logger.WithFields(fields), limiter: l.limiter}
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogRateLimiter(t *testing.T) {
+	r := &logRateLimiter{limit: 2}
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := r.allow(now); !ok {
+			t.Fatalf("Expected message %d to be allowed", i)
+		}
+	}
+	if ok, _ := r.allow(now); ok {
+		t.Fatal("Expected a message over the limit to be dropped")
+	}
+	ok, dropped := r.allow(now.Add(time.Second))
+	if !ok || dropped != 1 {
+		t.Fatalf("Expected the next window to allow messages and report 1 dropped, got %v, %d", ok, dropped)
+	}
+}
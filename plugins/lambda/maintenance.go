@@ -0,0 +1,116 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaintenanceTask is low priority work that runs when the extension has handled an invoke, before
+// it asks for the next event. A task must return when its context is done, because the budget can
+// only be kept if every task can be interrupted.
+type MaintenanceTask func(ctx context.Context) error
+
+// maintenanceTask is a registered maintenance task.
+type maintenanceTask struct {
+	name string
+	run  MaintenanceTask
+}
+
+// journalFlushTask is the name of the built-in maintenance task that writes the invokes recorded
+// in the journal to its file.
+const journalFlushTask = "journal_flush"
+
+// registeredMaintenanceTasks are the maintenance tasks registered by custom builds, in the order
+// they were registered.
+var registeredMaintenanceTasks = []maintenanceTask{}
+
+// RegisterMaintenanceTask adds a maintenance task under a name, which identifies it in the logs.
+// Custom builds must register their tasks before the plugin configuration is validated, e.g. in
+// an init function.
+func RegisterMaintenanceTask(name string, task MaintenanceTask) error {
+	if name == journalFlushTask {
+		return fmt.Errorf("maintenance task %q is built in", name)
+	}
+	for _, registered := range registeredMaintenanceTasks {
+		if registered.name == name {
+			return fmt.Errorf("maintenance task %q is already registered", name)
+		}
+	}
+	registeredMaintenanceTasks = append(registeredMaintenanceTasks, maintenanceTask{name: name, run: task})
+	return nil
+}
+
+// maintenanceTasks returns the built-in maintenance tasks for a journal, followed by the registered
+// ones, in the order they run.
+func maintenanceTasks(j *journal) []maintenanceTask {
+	tasks := []maintenanceTask{}
+	if j != nil {
+		tasks = append(tasks, maintenanceTask{name: journalFlushTask, run: j.flush})
+	}
+	return append(tasks, registeredMaintenanceTasks...)
+}
+
+// maintenanceScheduler runs the maintenance tasks at most once per interval of wall time, within a
+// budget per invoke. Tasks that don't fit in the budget of one invoke run first on the next one.
+type maintenanceScheduler struct {
+	tasks    []maintenanceTask
+	interval time.Duration
+	budget   time.Duration
+	lastRun  map[string]time.Time
+}
+
+// newMaintenanceScheduler returns a scheduler, or nil if maintenance is disabled.
+func newMaintenanceScheduler(tasks []maintenanceTask, interval, budget time.Duration) *maintenanceScheduler {
+	if budget <= 0 {
+		return nil
+	}
+	return &maintenanceScheduler{tasks: tasks, interval: interval, budget: budget, lastRun: map[string]time.Time{}}
+}
+
+// due returns the tasks that haven't run for the interval, the ones that have waited longest
+// first.
+func (s *maintenanceScheduler) due(now time.Time) []maintenanceTask {
+	due := []maintenanceTask{}
+	for _, task := range s.tasks {
+		if now.Sub(s.lastRun[task.name]) >= s.interval {
+			due = append(due, task)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return s.lastRun[due[i].name].Before(s.lastRun[due[j].name])
+	})
+	return due
+}
+
+// runMaintenance runs the maintenance tasks that are due until the budget is used up. The tasks
+// get the remaining budget as their deadline. The interval is measured in wall time, not in the
+// time basis of the plugins.
+func (p *Plugin) runMaintenance(ctx context.Context) {
+	s := p.maintenance
+	if s == nil {
+		return
+	}
+	tasks := s.due(time.Now())
+	if len(tasks) == 0 {
+		return
+	}
+	mCtx, cancel := context.WithTimeout(ctx, s.budget)
+	defer cancel()
+	for _, task := range tasks {
+		if mCtx.Err() != nil {
+			p.logger.Debug("Maintenance budget of %v used up, deferring the remaining tasks.", s.budget)
+			return
+		}
+		started := time.Now()
+		if err := task.run(mCtx); err != nil {
+			p.logger.Warn("Maintenance task %s failed, %v", task.name, err)
+		}
+		s.lastRun[task.name] = time.Now()
+		p.logger.Debug("Ran maintenance task %s in %v.", task.name, time.Since(started))
+	}
+}
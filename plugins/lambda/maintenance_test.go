@@ -0,0 +1,116 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func maintenanceTaskNames(tasks []maintenanceTask) []string {
+	names := []string{}
+	for _, task := range tasks {
+		names = append(names, task.name)
+	}
+	return names
+}
+
+func TestMaintenanceDisabled(t *testing.T) {
+	if s := newMaintenanceScheduler(maintenanceTasks(nil), time.Minute, 0); s != nil {
+		t.Fatalf("Expected no scheduler, got %v", s)
+	}
+}
+
+func TestRunMaintenance(t *testing.T) {
+	p := newTestPlugin(t, `{"maintenance_budget_ms": 50, "maintenance_interval": 60}`)
+	ran := []string{}
+	task := func(name string, d time.Duration) maintenanceTask {
+		return maintenanceTask{name: name, run: func(ctx context.Context) error {
+			ran = append(ran, name)
+			select {
+			case <-ctx.Done():
+			case <-time.After(d):
+			}
+			return nil
+		}}
+	}
+	p.maintenance.tasks = []maintenanceTask{task("slow", time.Second), task("fast", 0)}
+
+	// the slow task uses up the budget, so the fast task is deferred
+	p.runMaintenance(context.Background())
+	if !reflect.DeepEqual(ran, []string{"slow"}) {
+		t.Fatalf("Expected only the slow task to run, got %v", ran)
+	}
+	// the deferred task is the only one due
+	if due := maintenanceTaskNames(p.maintenance.due(time.Now())); !reflect.DeepEqual(due, []string{"fast"}) {
+		t.Fatalf("Expected the fast task to be due, got %v", due)
+	}
+	p.runMaintenance(context.Background())
+	if !reflect.DeepEqual(ran, []string{"slow", "fast"}) {
+		t.Fatalf("Expected the fast task to run next, got %v", ran)
+	}
+	// nothing is due until the interval has elapsed
+	if due := p.maintenance.due(time.Now()); len(due) != 0 {
+		t.Fatalf("Expected no tasks to be due, got %v", maintenanceTaskNames(due))
+	}
+	if due := maintenanceTaskNames(p.maintenance.due(time.Now().Add(2 * time.Minute))); !reflect.DeepEqual(due, []string{"slow", "fast"}) {
+		t.Fatalf("Expected all tasks to be due, oldest first, got %v", due)
+	}
+}
+
+func TestRegisterMaintenanceTask(t *testing.T) {
+	if p := newTestPlugin(t, `{"maintenance_budget_ms": 50}`); len(p.maintenance.tasks) != 0 {
+		t.Fatalf("Expected no built-in tasks, got %v", maintenanceTaskNames(p.maintenance.tasks))
+	}
+	ran := false
+	task := func(context.Context) error {
+		ran = true
+		return nil
+	}
+	if err := RegisterMaintenanceTask("compact", task); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { registeredMaintenanceTasks = []maintenanceTask{} }()
+	if err := RegisterMaintenanceTask("compact", task); err == nil {
+		t.Fatal("Expected an error when registering a task twice")
+	}
+	if err := RegisterMaintenanceTask(journalFlushTask, task); err == nil {
+		t.Fatal("Expected an error when registering a task under the name of a built-in task")
+	}
+
+	p := newTestPlugin(t, `{"maintenance_budget_ms": 50}`)
+	p.runMaintenance(context.Background())
+	if !ran {
+		t.Fatal("Expected the registered task to run")
+	}
+}
+
+func TestJournalFlushTask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	p := newTestPlugin(t, fmt.Sprintf(`{"maintenance_budget_ms": 50, "journal_path": %q}`, path))
+	if names := maintenanceTaskNames(p.maintenance.tasks); !reflect.DeepEqual(names, []string{journalFlushTask}) {
+		t.Fatalf("Expected the journal_flush task, got %v", names)
+	}
+	written := func() []string {
+		entries, err := newJournal(path, 10, "").load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return journalEvents(entries)
+	}
+
+	p.recordJournal(journalStart, "")
+	p.recordInvokeJournal("a")
+	if events := written(); !reflect.DeepEqual(events, []string{"start:"}) {
+		t.Fatalf("Expected the invoke not to be written until the journal is flushed, got %v", events)
+	}
+	p.runMaintenance(context.Background())
+	if events := written(); !reflect.DeepEqual(events, []string{"start:", "invoke:a"}) {
+		t.Fatalf("Expected the invoke to be written by the journal_flush task, got %v", events)
+	}
+}
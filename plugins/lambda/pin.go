@@ -0,0 +1,136 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/open-policy-agent/opa/plugins/bundle"
+)
+
+const (
+	// revisionPinEnvVar pins the bundles to a revision. The value is either a revision that all
+	// bundles are pinned to, or a comma separated list of bundle=revision pairs.
+	revisionPinEnvVar = "OPA_LAMBDA_BUNDLE_REVISION_PIN"
+	// freezeRevision pins a bundle to whatever revision is activated first.
+	freezeRevision = "*"
+	// allBundles is the key of the pin that applies to every bundle.
+	allBundles = ""
+	// the error reported when a bundle activates a revision other than the pinned one
+	revisionPinErrorType = "Extension.RevisionPinViolated"
+)
+
+// revisionPin stops the bundle plugin from being triggered once the pinned revisions are active,
+// so no newer revision is downloaded. The bundle plugin activates whatever revision the bundle
+// server serves, so a pin can't stop a different revision from being activated before the
+// pinned one, but the extension then fails closed by reporting an exit error and exiting. A nil
+// revisionPin pins nothing.
+type revisionPin struct {
+	mtx    sync.Mutex
+	pins   map[string]string
+	active map[string]string
+}
+
+// parseRevisionPin parses the value of the revision pin environment variable.
+func parseRevisionPin(value string) (*revisionPin, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	pins := map[string]string{}
+	if !strings.Contains(value, "=") {
+		pins[allBundles] = value
+	} else {
+		for _, pair := range strings.Split(value, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("invalid %s %q, must be a revision or bundle=revision pairs", revisionPinEnvVar, value)
+			}
+			pins[parts[0]] = parts[1]
+		}
+	}
+	return &revisionPin{pins: pins, active: map[string]string{}}, nil
+}
+
+func (r *revisionPin) pin(name string) (string, bool) {
+	if revision, ok := r.pins[name]; ok {
+		return revision, true
+	}
+	revision, ok := r.pins[allBundles]
+	return revision, ok
+}
+
+// update records the active revision of a bundle, and returns an error if the revision isn't
+// the pinned one.
+func (r *revisionPin) update(status bundle.Status) error {
+	if r == nil || status.ActiveRevision == "" {
+		return nil
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	pinned, ok := r.pin(status.Name)
+	if !ok {
+		return nil
+	}
+	previous, wasActive := r.active[status.Name]
+	r.active[status.Name] = status.ActiveRevision
+	if pinned == freezeRevision {
+		if wasActive && previous != status.ActiveRevision {
+			return fmt.Errorf("bundle %s activated revision %q, but it was frozen at revision %q", status.Name, status.ActiveRevision, previous)
+		}
+		return nil
+	}
+	if status.ActiveRevision != pinned {
+		return fmt.Errorf("bundle %s activated revision %q, but it is pinned to revision %q", status.Name, status.ActiveRevision, pinned)
+	}
+	return nil
+}
+
+// holds returns true if every pinned bundle has its pinned revision active, so the bundle plugin
+// must no longer be triggered. A pin for all bundles holds once every configured bundle has the
+// pinned revision active.
+func (r *revisionPin) holds(configured []string) bool {
+	if r == nil {
+		return false
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	names := []string{}
+	for name := range r.pins {
+		if name != allBundles {
+			names = append(names, name)
+		}
+	}
+	if _, ok := r.pins[allBundles]; ok {
+		if len(configured) == 0 {
+			return false
+		}
+		names = append(names, configured...)
+	}
+	for _, name := range names {
+		active, ok := r.active[name]
+		if !ok {
+			return false
+		}
+		if pinned, _ := r.pin(name); pinned != freezeRevision && active != pinned {
+			return false
+		}
+	}
+	return true
+}
+
+// configuredBundles returns the names of the bundles that the bundle plugin is configured with.
+func (p *Plugin) configuredBundles() []string {
+	plugin := bundle.Lookup(p.manager)
+	if plugin == nil {
+		return nil
+	}
+	names := []string{}
+	for name := range plugin.Config().Bundles {
+		names = append(names, name)
+	}
+	return names
+}
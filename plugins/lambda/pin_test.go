@@ -0,0 +1,97 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"os"
+	"testing"
+
+	"github.com/open-policy-agent/opa/plugins/bundle"
+)
+
+func TestParseRevisionPin(t *testing.T) {
+	if pin, err := parseRevisionPin(""); pin != nil || err != nil {
+		t.Fatalf("Expected no pin, got %v, %v", pin, err)
+	}
+	pin, err := parseRevisionPin("authz=abc, data=*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.pins) != 2 || pin.pins["authz"] != "abc" || pin.pins["data"] != freezeRevision {
+		t.Fatalf("Expected pins for authz and data, got %v", pin.pins)
+	}
+	if _, err := parseRevisionPin("authz=abc,data"); err == nil {
+		t.Fatal("Expected an error for a pair without a revision")
+	}
+}
+
+func TestRevisionPinHolds(t *testing.T) {
+	pin, err := parseRevisionPin("authz=abc,data=*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.holds(nil) {
+		t.Fatal("Expected the pin not to hold before any bundle is active")
+	}
+	if err := pin.update(bundle.Status{Name: "authz", ActiveRevision: "old"}); err == nil {
+		t.Fatal("Expected an error for a revision that isn't pinned")
+	}
+	if err := pin.update(bundle.Status{Name: "authz", ActiveRevision: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if pin.holds(nil) {
+		t.Fatal("Expected the pin not to hold before the frozen bundle is active")
+	}
+	if err := pin.update(bundle.Status{Name: "data", ActiveRevision: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !pin.holds(nil) {
+		t.Fatal("Expected the pin to hold once all pinned bundles are active")
+	}
+	if err := pin.update(bundle.Status{Name: "data", ActiveRevision: "v2"}); err == nil {
+		t.Fatal("Expected an error for a frozen bundle that changed revision")
+	}
+}
+
+func TestRevisionPinAllBundles(t *testing.T) {
+	pin, err := parseRevisionPin("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configured := []string{"authz", "data"}
+	_ = pin.update(bundle.Status{Name: "authz", ActiveRevision: "abc"})
+	if pin.holds(configured) {
+		t.Fatal("Expected the pin not to hold while a configured bundle hasn't been downloaded")
+	}
+	_ = pin.update(bundle.Status{Name: "data", ActiveRevision: "def"})
+	if pin.holds(configured) {
+		t.Fatal("Expected the pin not to hold while a bundle has another revision")
+	}
+	_ = pin.update(bundle.Status{Name: "data", ActiveRevision: "abc"})
+	if !pin.holds(configured) {
+		t.Fatal("Expected the pin to hold once all bundles have the pinned revision")
+	}
+	if pin.holds(nil) {
+		t.Fatal("Expected the pin not to hold without configured bundles")
+	}
+}
+
+func TestRevisionPinViolationFailsClosed(t *testing.T) {
+	os.Setenv(revisionPinEnvVar, "abc")
+	defer os.Unsetenv(revisionPinEnvVar)
+	p := newTestPlugin(t, `{}`)
+	p.client = NewClient("127.0.0.1:0")
+
+	exited := false
+	exit = func(int) { exited = true }
+	defer func() { exit = os.Exit }()
+	p.bundleStatusUpdated(bundle.Status{Name: "authz", ActiveRevision: "abc"})
+	if exited {
+		t.Fatal("Expected the pinned revision not to make the extension exit")
+	}
+	p.bundleStatusUpdated(bundle.Status{Name: "authz", ActiveRevision: "def"})
+	if !exited {
+		t.Fatal("Expected the extension to exit when a revision violates the pin")
+	}
+}
@@ -6,13 +6,20 @@ package lambda
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/godaddy/opa-lambda-extension-plugin/profiles"
+
 	"github.com/open-policy-agent/opa/logging"
+	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/plugins"
-	"github.com/open-policy-agent/opa/runtime"
+	"github.com/open-policy-agent/opa/plugins/bundle"
+	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -21,10 +28,79 @@ const (
 	Name                           = "lambda_extension"
 	defaultTriggerTimeout          = int(7)
 	defaultMinimumTriggerThreshold = int(30)
+	defaultWatchdogTimeout         = int(15)
+	defaultExtensionMode           = ExternalMode
+	defaultTriggerStrategy         = IntervalTriggerStrategy
+	defaultTriggerInvokeCount      = int(10)
+	defaultTimeBasis               = WallTimeBasis
+	defaultInitTimeout             = int(0)
+	defaultInitTimeoutBehavior     = DelayInitTimeoutBehavior
+	defaultInlineBundle            = ""
+	defaultRunPolicyTests          = false
+	defaultParallelStart           = false
+	defaultDiagnosticsAddr         = ""
+	defaultEnablePprof             = false
+	defaultJournalPath             = ""
+	defaultJournalSize             = int(100)
+	defaultCrashLoopThreshold      = int(3)
+	defaultBreakerThreshold        = int(0)
+	defaultBreakerCooldown         = int(60)
+	defaultRequireFIPS             = false
+	defaultEMFNamespace            = ""
+	defaultBundleStalenessSLA      = int(0)
+	defaultEMFInvokeMetrics        = false
+	defaultBundleStalenessAction   = WarnStalenessAction
+	defaultLogLevel                = ""
+	defaultLogRateLimit            = int(0)
+	defaultMaintenanceBudget       = int(0)
+	defaultMaintenanceInterval     = int(60)
+	watchdogErrorType              = "Extension.Watchdog"
+	initTimeoutErrorType           = "Extension.InitTimeout"
+	invalidIDErrorType             = "Extension.InvalidExtensionID"
+	fipsErrorType                  = "Extension.FIPSUnavailable"
+	policyTestErrorType            = "Extension.PolicyTestFailure"
+	diagnosticsErrorType           = "Extension.DiagnosticsUnavailable"
+	// the labels that the account ID of the function and the version of the extension are added
+	// to, unless they're already configured
+	accountIDLabel        = "aws_account_id"
+	extensionVersionLabel = "lambda_extension_version"
+	// the path in the store that the account ID is written to, so policies can read it as
+	// data.lambda_extension.account_id
+	accountIDDataPath = "/lambda_extension"
+	// Histograms, in nanoseconds, of the time between receiving an event from the Lambda service
+	// and asking it for the next event, i.e. the latency that the extension adds to the event
+	invokeOverheadMetric   = "lambda_extension_invoke_overhead_ns"
+	shutdownOverheadMetric = "lambda_extension_shutdown_overhead_ns"
+	// The number of times in a row that the extension will try to register again after the
+	// Extensions API rejects its identifier
+	maxReregistrations = 2
+)
+
+// Init timeout behaviors
+const (
+	// DelayInitTimeoutBehavior keeps waiting for initialization to complete.
+	DelayInitTimeoutBehavior = "delay"
+	// FailOpenInitTimeoutBehavior starts handling events while initialization continues in the
+	// background. Plugins are not triggered by invokes until initialization completes.
+	FailOpenInitTimeoutBehavior = "fail_open"
+	// FailClosedInitTimeoutBehavior reports an init error to the Lambda service and exits.
+	FailClosedInitTimeoutBehavior = "fail_closed"
+)
+
+// Extension modes
+const (
+	// ExternalMode runs the plugin in an external extension, i.e. a separate process from the
+	// function that is started from a Lambda layer.
+	ExternalMode = "external"
+	// InternalMode runs the plugin in an internal extension, i.e. inside the function process.
+	// Internal extensions cannot receive shutdown events, so the function is responsible for
+	// calling Flush before it exits.
+	InternalMode = "internal"
 )
 
 var (
 	extensionName = filepath.Base(os.Args[0]) // extension name has to match the filename
+	exit          = os.Exit
 	// Decision logs are typically the most important plugin to trigger when lambda is shutting down.
 	// Status is nice to have, but not critical as the instance will disappear in just a second.
 	// Bundle and discovery don't do anything on shutdown.
@@ -34,6 +110,14 @@ var (
 		"bundle",
 		"discovery",
 	}
+	// When plugins are started in parallel, everything waits for discovery, because discovery can
+	// reconfigure the other plugins, and status waits for everything else for the same reason it
+	// is started last.
+	defaultPluginStartDependencies = map[string][]string{
+		"bundle":        {"discovery"},
+		"decision_logs": {"discovery"},
+		"status":        {"discovery", "bundle", "decision_logs"},
+	}
 	// Discovery should always be started first, followed by bundle.
 	// Status should be last so that the statuses of all other plugins are available to report.
 	defaultPluginStartPriority = []string{
@@ -46,16 +130,124 @@ var (
 
 // Config represents the plugin configuration.
 type Config struct {
-	// The minimum time in seconds that must elapse before plugins will be triggered. Right now,
-	// all plugins are triggered at once, and they all must use the same minimum threshold.
+	// The minimum time in seconds that must elapse before plugins will be triggered by the interval
+	// trigger strategy.
 	MinimumTriggerThreshold *int `json:"minimum_trigger_threshold,omitempty"`
+	// The strategy that decides which invokes trigger the plugins, one of "interval",
+	// "every_invoke", or "every_n_invokes".
+	TriggerStrategy *string `json:"trigger_strategy,omitempty"`
+	// The number of invokes between triggers for the every_n_invokes trigger strategy.
+	TriggerInvokeCount *int `json:"trigger_invoke_count,omitempty"`
+	// Whether the minimum trigger threshold and the breaker cooldown are measured in "wall" time,
+	// or in "warm" time, which excludes the time the execution environment spent frozen between
+	// invokes.
+	TimeBasis *string `json:"time_basis,omitempty"`
+	// Trigger strategies for individual plugins, keyed by plugin name. Plugins that aren't listed
+	// here use the top level trigger strategy.
+	Triggers map[string]*TriggerConfig `json:"triggers,omitempty"`
 	// The maximum time in seconds that ALL plugins have to run. Once the timeout elapses, all plugin
 	// runs will be cancelled and the lambda_extension plugin will move on to the next event.
 	TriggerTimeout *int `json:"trigger_timeout,omitempty"`
 	// The order, from first to last, that plugins will be started during intialization.
 	PluginStartPriority *[]string `json:"plugin_start_priority,omitempty"`
+	// Whether plugins are started in parallel during initialization, instead of one by one in the
+	// order of the plugin start priority. Each plugin is started as soon as the plugins it depends
+	// on have started, and all of them share the trigger timeout, as they do when started in order.
+	ParallelStart *bool `json:"parallel_start,omitempty"`
+	// The plugins, keyed by plugin name, that must be started before a plugin is started in
+	// parallel. Only the plugins in the plugin start priority are started.
+	PluginStartDependencies map[string][]string `json:"plugin_start_dependencies,omitempty"`
 	// the order, from first to last, that plugins will be stopped during shutdown.
 	PluginStopPriority *[]string `json:"plugin_stop_priority,omitempty"`
+	// The maximum time in seconds that the extension may spend handling a single event. If the
+	// watchdog expires, or the deadline for the event passes first, the extension reports an exit
+	// error to the Lambda service and exits. A value of 0 disables the watchdog.
+	WatchdogTimeout *int `json:"watchdog_timeout,omitempty"`
+	// Whether the plugin runs in an external extension (the default) or an internal extension.
+	ExtensionMode *string `json:"extension_mode,omitempty"`
+	// The maximum time in seconds that initialization, i.e. starting the plugins and running the
+	// policy tests, may take before the extension asks for the first event. A value of 0 means no
+	// limit. Lambda limits the init phase of the function to 10 seconds.
+	InitTimeout *int `json:"init_timeout,omitempty"`
+	// What to do when the init timeout elapses, one of "delay", "fail_open", or "fail_closed".
+	InitTimeoutBehavior *string `json:"init_timeout_behavior,omitempty"`
+	// Rego policies, keyed by policy ID, e.g. authz.rego, that are compiled and activated at init,
+	// so simple policies don't need a bundle server. Their packages must not be under the roots of
+	// a bundle, or activating the bundle removes them.
+	Policies map[string]string `json:"policies,omitempty"`
+	// A bundle, i.e. a base64 encoded tarball as built by opa build, that is activated at init as
+	// the "inline" bundle, so a bundle with data or several policies doesn't need a bundle server.
+	InlineBundle *string `json:"inline_bundle,omitempty"`
+	// Whether to run the policy tests, i.e. the test_ rules included in the bundles, after the
+	// plugins have been started. If any test fails, the extension reports an init error to the
+	// Lambda service, so the function never serves requests with policies that fail their own tests.
+	RunPolicyTests *bool `json:"run_policy_tests,omitempty"`
+	// The address, e.g. localhost:8182, of a listener that serves diagnostic endpoints like
+	// /debug/dump. The listener is disabled when the address is empty.
+	DiagnosticsAddr *string `json:"diagnostics_addr,omitempty"`
+	// Whether the diagnostics listener serves the net/http/pprof endpoints under /debug/pprof/.
+	EnablePprof *bool `json:"enable_pprof,omitempty"`
+	// The path of a file, e.g. /tmp/opa-lambda-extension.journal, that keeps a journal of the
+	// last lifecycle events of the extension. The journal is disabled when the path is empty.
+	JournalPath *string `json:"journal_path,omitempty"`
+	// The maximum number of events kept in the journal.
+	JournalSize *int `json:"journal_size,omitempty"`
+	// The number of consecutive starts that failed to initialize, according to the journal, after
+	// which the extension starts degraded: the policy tests are skipped, and the fail_closed init
+	// timeout behavior becomes fail_open. A value of 0 disables crash loop detection.
+	CrashLoopThreshold *int `json:"crash_loop_threshold,omitempty"`
+	// The number of consecutive trigger failures after which a plugin is no longer triggered until
+	// the breaker cooldown has elapsed. A value of 0 disables the circuit breakers.
+	BreakerThreshold *int `json:"breaker_threshold,omitempty"`
+	// The time in seconds that a plugin isn't triggered after its circuit breaker opens.
+	BreakerCooldown *int `json:"breaker_cooldown,omitempty"`
+	// The retry policy for Extensions API calls and plugin triggers.
+	Retry *RetryConfig `json:"retry,omitempty"`
+	// Retry policies that override the top level retry policy, keyed by component, i.e.
+	// extensions_api or a plugin name.
+	Retries map[string]*RetryConfig `json:"retries,omitempty"`
+	// Whether the extension must use FIPS 140-2 validated cryptography. If it wasn't built for
+	// FIPS mode, the extension reports an init error to the Lambda service.
+	RequireFIPS *bool `json:"require_fips,omitempty"`
+	// The CloudWatch namespace of the metrics that the extension writes to its logs in the embedded
+	// metric format. Metrics are disabled when the namespace is empty.
+	EMFNamespace *string `json:"emf_namespace,omitempty"`
+	// Whether the resources that the extension used for every invoke are written as metrics.
+	// Requires the EMF namespace to be set.
+	EMFInvokeMetrics *bool `json:"emf_invoke_metrics,omitempty"`
+	// The maximum time in seconds since the bundle server last confirmed that a bundle is current,
+	// before the bundle is considered stale. A value of 0 disables the staleness monitor.
+	BundleStalenessSLA *int `json:"bundle_staleness_sla,omitempty"`
+	// What to do when a bundle is stale, either "warn" or "fail_closed".
+	BundleStalenessAction *string `json:"bundle_staleness_action,omitempty"`
+	// The level of the plugin's own logger, one of "debug", "info", "warn", or "error". When it's
+	// set, the plugin logs to stderr independently of OPA's log level. When it's empty, the plugin
+	// logs through OPA's logger.
+	LogLevel *string `json:"log_level,omitempty"`
+	// The maximum number of debug, info, and warning messages per second that the plugin logs.
+	// Errors are always logged. A value of 0 means no limit.
+	LogRateLimit *int `json:"log_rate_limit,omitempty"`
+	// The time in milliseconds that maintenance tasks may take after an invoke has been handled,
+	// before the extension asks for the next event. A value of 0 disables maintenance.
+	MaintenanceBudget *int `json:"maintenance_budget_ms,omitempty"`
+	// The minimum time in seconds between two runs of a maintenance task, measured in wall time.
+	MaintenanceInterval *int `json:"maintenance_interval,omitempty"`
+	// Labels that are added to the labels of the OPA instance when the extension registers. Values
+	// can reference the ARN of the function, e.g. {account}/{function}, or be text/templates, e.g.
+	// {{ .Function }}-{{ date "2006-01" }}. They're the only values that are templated, because the
+	// services and sinks are parsed by the plugin manager before the ARN is known.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Faults to inject for resilience testing. Fault injection is disabled when it isn't set.
+	FaultInjection *FaultInjectionConfig `json:"fault_injection,omitempty"`
+}
+
+// TriggerConfig represents the trigger strategy for a single plugin. Fields that aren't set are
+// inherited from the top level configuration.
+type TriggerConfig struct {
+	Strategy         *string `json:"strategy,omitempty"`
+	MinimumThreshold *int    `json:"minimum_threshold,omitempty"`
+	InvokeCount      *int    `json:"invoke_count,omitempty"`
+	TimeBasis        *string `json:"time_basis,omitempty"`
 }
 
 // PluginFactory is used by the plugin manager to create plugins and their configuration
@@ -80,9 +272,70 @@ func (p *PluginFactory) Validate(manager *plugins.Manager, config []byte) (inter
 		parsedConfig.MinimumTriggerThreshold = &minimumTriggerThreshold
 	}
 
+	triggerStrategy := defaultTriggerStrategy
+	if parsedConfig.TriggerStrategy == nil {
+		parsedConfig.TriggerStrategy = &triggerStrategy
+	}
+
+	triggerInvokeCount := defaultTriggerInvokeCount
+	if parsedConfig.TriggerInvokeCount == nil {
+		parsedConfig.TriggerInvokeCount = &triggerInvokeCount
+	}
+
+	timeBasis := defaultTimeBasis
+	if parsedConfig.TimeBasis == nil {
+		parsedConfig.TimeBasis = &timeBasis
+	} else if err := validateTimeBasis(*parsedConfig.TimeBasis); err != nil {
+		return nil, err
+	}
+
+	if _, err := parsedConfig.newTriggerStrategy(); err != nil {
+		return nil, err
+	}
+
+	for pluginName, trigger := range parsedConfig.Triggers {
+		if err := checkPluginName(manager, pluginName); err != nil {
+			return nil, fmt.Errorf("invalid triggers, %v", err)
+		}
+		if trigger == nil {
+			trigger = &TriggerConfig{}
+			parsedConfig.Triggers[pluginName] = trigger
+		}
+		if trigger.Strategy == nil {
+			trigger.Strategy = parsedConfig.TriggerStrategy
+		}
+		if trigger.MinimumThreshold == nil {
+			trigger.MinimumThreshold = parsedConfig.MinimumTriggerThreshold
+		}
+		if trigger.InvokeCount == nil {
+			trigger.InvokeCount = parsedConfig.TriggerInvokeCount
+		}
+		if trigger.TimeBasis == nil {
+			trigger.TimeBasis = parsedConfig.TimeBasis
+		} else if err := validateTimeBasis(*trigger.TimeBasis); err != nil {
+			return nil, fmt.Errorf("invalid trigger for plugin %q, %v", pluginName, err)
+		}
+		if _, err := trigger.newTriggerStrategy(); err != nil {
+			return nil, fmt.Errorf("invalid trigger for plugin %q, %v", pluginName, err)
+		}
+	}
+
 	pluginStartPriority := defaultPluginStartPriority
 	if parsedConfig.PluginStartPriority == nil {
 		parsedConfig.PluginStartPriority = &pluginStartPriority
+	} else if err := checkDuplicates(*parsedConfig.PluginStartPriority); err != nil {
+		return nil, fmt.Errorf("invalid plugin_start_priority, %v", err)
+	}
+
+	parallelStart := defaultParallelStart
+	if parsedConfig.ParallelStart == nil {
+		parsedConfig.ParallelStart = &parallelStart
+	}
+
+	if parsedConfig.PluginStartDependencies == nil {
+		parsedConfig.PluginStartDependencies = defaultPluginStartDependencies
+	} else if err := checkDependencyCycles(parsedConfig.PluginStartDependencies); err != nil {
+		return nil, fmt.Errorf("invalid plugin_start_dependencies, %v", err)
 	}
 
 	pluginStopPriority := defaultPluginStopPriority
@@ -90,37 +343,353 @@ func (p *PluginFactory) Validate(manager *plugins.Manager, config []byte) (inter
 		parsedConfig.PluginStopPriority = &pluginStopPriority
 	}
 
+	watchdogTimeout := defaultWatchdogTimeout
+	if parsedConfig.WatchdogTimeout == nil {
+		parsedConfig.WatchdogTimeout = &watchdogTimeout
+	}
+
+	extensionMode := defaultExtensionMode
+	if parsedConfig.ExtensionMode == nil {
+		parsedConfig.ExtensionMode = &extensionMode
+	} else if *parsedConfig.ExtensionMode != ExternalMode && *parsedConfig.ExtensionMode != InternalMode {
+		return nil, fmt.Errorf("invalid extension_mode %q, must be %q or %q", *parsedConfig.ExtensionMode, ExternalMode, InternalMode)
+	}
+
+	initTimeout := defaultInitTimeout
+	if parsedConfig.InitTimeout == nil {
+		parsedConfig.InitTimeout = &initTimeout
+	}
+
+	initTimeoutBehavior := defaultInitTimeoutBehavior
+	if parsedConfig.InitTimeoutBehavior == nil {
+		parsedConfig.InitTimeoutBehavior = &initTimeoutBehavior
+	} else {
+		switch *parsedConfig.InitTimeoutBehavior {
+		case DelayInitTimeoutBehavior, FailOpenInitTimeoutBehavior, FailClosedInitTimeoutBehavior:
+		default:
+			return nil, fmt.Errorf("invalid init_timeout_behavior %q, must be %q, %q, or %q", *parsedConfig.InitTimeoutBehavior,
+				DelayInitTimeoutBehavior, FailOpenInitTimeoutBehavior, FailClosedInitTimeoutBehavior)
+		}
+	}
+
+	runPolicyTests := defaultRunPolicyTests
+	if parsedConfig.RunPolicyTests == nil {
+		parsedConfig.RunPolicyTests = &runPolicyTests
+	} else if *parsedConfig.RunPolicyTests && !profiles.Current().PolicyTests {
+		return nil, fmt.Errorf("run_policy_tests is not available in the %s build profile", profiles.Current().Name)
+	}
+
+	if err := validatePolicies(parsedConfig.Policies); err != nil {
+		return nil, err
+	}
+
+	inlineBundle := defaultInlineBundle
+	if parsedConfig.InlineBundle == nil {
+		parsedConfig.InlineBundle = &inlineBundle
+	}
+	if *parsedConfig.InlineBundle != "" {
+		if _, err := decodeInlineBundle(*parsedConfig.InlineBundle); err != nil {
+			return nil, err
+		}
+	}
+
+	diagnosticsAddr := defaultDiagnosticsAddr
+	if parsedConfig.DiagnosticsAddr == nil {
+		parsedConfig.DiagnosticsAddr = &diagnosticsAddr
+	}
+
+	enablePprof := defaultEnablePprof
+	if parsedConfig.EnablePprof == nil {
+		parsedConfig.EnablePprof = &enablePprof
+	} else if *parsedConfig.EnablePprof && *parsedConfig.DiagnosticsAddr == "" {
+		return nil, fmt.Errorf("enable_pprof requires diagnostics_addr to be set")
+	} else if *parsedConfig.EnablePprof && !profiles.Current().Pprof {
+		return nil, fmt.Errorf("enable_pprof is not available in the %s build profile", profiles.Current().Name)
+	}
+
+	journalPath := defaultJournalPath
+	if parsedConfig.JournalPath == nil {
+		parsedConfig.JournalPath = &journalPath
+	}
+
+	journalSize := defaultJournalSize
+	if parsedConfig.JournalSize == nil {
+		parsedConfig.JournalSize = &journalSize
+	} else if *parsedConfig.JournalSize < 1 {
+		return nil, fmt.Errorf("journal_size must be at least 1")
+	}
+
+	crashLoopThreshold := defaultCrashLoopThreshold
+	if parsedConfig.CrashLoopThreshold == nil {
+		parsedConfig.CrashLoopThreshold = &crashLoopThreshold
+	}
+
+	breakerThreshold := defaultBreakerThreshold
+	if parsedConfig.BreakerThreshold == nil {
+		parsedConfig.BreakerThreshold = &breakerThreshold
+	}
+
+	breakerCooldown := defaultBreakerCooldown
+	if parsedConfig.BreakerCooldown == nil {
+		parsedConfig.BreakerCooldown = &breakerCooldown
+	}
+
+	if parsedConfig.Retry == nil {
+		parsedConfig.Retry = defaultRetryConfig()
+	} else {
+		parsedConfig.Retry.inherit(defaultRetryConfig())
+	}
+	if err := parsedConfig.Retry.validate(); err != nil {
+		return nil, fmt.Errorf("invalid retry, %v", err)
+	}
+	requireFIPS := defaultRequireFIPS
+	if parsedConfig.RequireFIPS == nil {
+		parsedConfig.RequireFIPS = &requireFIPS
+	}
+
+	emfNamespace := defaultEMFNamespace
+	if parsedConfig.EMFNamespace == nil {
+		parsedConfig.EMFNamespace = &emfNamespace
+	}
+
+	emfInvokeMetrics := defaultEMFInvokeMetrics
+	if parsedConfig.EMFInvokeMetrics == nil {
+		parsedConfig.EMFInvokeMetrics = &emfInvokeMetrics
+	} else if *parsedConfig.EMFInvokeMetrics && *parsedConfig.EMFNamespace == "" {
+		return nil, fmt.Errorf("emf_invoke_metrics requires emf_namespace to be set")
+	} else if *parsedConfig.EMFInvokeMetrics && *parsedConfig.ExtensionMode == InternalMode {
+		// an internal extension shares the process with the function, so the usage of the
+		// process can't be attributed to the extension
+		return nil, fmt.Errorf("emf_invoke_metrics is not supported with extension_mode %q", InternalMode)
+	}
+
+	bundleStalenessSLA := defaultBundleStalenessSLA
+	if parsedConfig.BundleStalenessSLA == nil {
+		parsedConfig.BundleStalenessSLA = &bundleStalenessSLA
+	}
+
+	if _, err := parseRevisionPin(os.Getenv(revisionPinEnvVar)); err != nil {
+		return nil, err
+	}
+
+	bundleStalenessAction := defaultBundleStalenessAction
+	if parsedConfig.BundleStalenessAction == nil {
+		parsedConfig.BundleStalenessAction = &bundleStalenessAction
+	} else if *parsedConfig.BundleStalenessAction != WarnStalenessAction && *parsedConfig.BundleStalenessAction != FailClosedStalenessAction {
+		return nil, fmt.Errorf("invalid bundle_staleness_action %q, must be %q or %q", *parsedConfig.BundleStalenessAction,
+			WarnStalenessAction, FailClosedStalenessAction)
+	}
+
+	for component, retry := range parsedConfig.Retries {
+		if component != extensionsAPIRetryComponent {
+			if err := checkPluginName(manager, component); err != nil {
+				return nil, fmt.Errorf("invalid retries, %v", err)
+			}
+		}
+		if retry == nil {
+			retry = &RetryConfig{}
+			parsedConfig.Retries[component] = retry
+		}
+		retry.inherit(parsedConfig.Retry)
+		if err := retry.validate(); err != nil {
+			return nil, fmt.Errorf("invalid retries for %q, %v", component, err)
+		}
+	}
+
+	logLevel := defaultLogLevel
+	if parsedConfig.LogLevel == nil {
+		parsedConfig.LogLevel = &logLevel
+	} else if *parsedConfig.LogLevel != "" {
+		if _, err := parseLogLevel(*parsedConfig.LogLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	logRateLimit := defaultLogRateLimit
+	if parsedConfig.LogRateLimit == nil {
+		parsedConfig.LogRateLimit = &logRateLimit
+	}
+
+	maintenanceBudget := defaultMaintenanceBudget
+	if parsedConfig.MaintenanceBudget == nil {
+		parsedConfig.MaintenanceBudget = &maintenanceBudget
+	}
+
+	maintenanceInterval := defaultMaintenanceInterval
+	if parsedConfig.MaintenanceInterval == nil {
+		parsedConfig.MaintenanceInterval = &maintenanceInterval
+	}
+
+	for name, label := range parsedConfig.Labels {
+		if err := validateTemplate(label); err != nil {
+			return nil, fmt.Errorf("invalid label %q, %v", name, err)
+		}
+	}
+
+	if parsedConfig.FaultInjection != nil {
+		for pluginName := range parsedConfig.FaultInjection.Plugins {
+			if err := checkPluginName(manager, pluginName); err != nil {
+				return nil, fmt.Errorf("invalid fault_injection, %v", err)
+			}
+		}
+		if err := parsedConfig.FaultInjection.validate(); err != nil {
+			return nil, fmt.Errorf("invalid fault_injection, %v", err)
+		}
+	}
+
 	return &parsedConfig, nil
 }
 
+// checkPluginName returns an error if a name used to configure a plugin, e.g. as a key of
+// triggers, is neither one of the plugins that OPA provides nor a plugin in the plugins section of
+// the OPA configuration, so a typo doesn't silently leave the plugin unconfigured.
+func checkPluginName(manager *plugins.Manager, name string) error {
+	for _, pluginName := range defaultPluginStartPriority {
+		if name == pluginName {
+			return nil
+		}
+	}
+	if name != Name && manager.Config != nil {
+		if _, ok := manager.Config.Plugins[name]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown plugin %q", name)
+}
+
 func defaultConfig() Config {
 	minimumTriggerThreshold := defaultMinimumTriggerThreshold
 	triggerTimeout := defaultTriggerTimeout
+	triggerStrategy := defaultTriggerStrategy
+	triggerInvokeCount := defaultTriggerInvokeCount
+	timeBasis := defaultTimeBasis
 	pluginStartPriority := defaultPluginStartPriority
+	parallelStart := defaultParallelStart
 	pluginStopPriority := defaultPluginStopPriority
+	watchdogTimeout := defaultWatchdogTimeout
+	extensionMode := defaultExtensionMode
+	initTimeout := defaultInitTimeout
+	initTimeoutBehavior := defaultInitTimeoutBehavior
+	inlineBundle := defaultInlineBundle
+	runPolicyTests := defaultRunPolicyTests
+	diagnosticsAddr := defaultDiagnosticsAddr
+	enablePprof := defaultEnablePprof
+	journalPath := defaultJournalPath
+	journalSize := defaultJournalSize
+	crashLoopThreshold := defaultCrashLoopThreshold
+	breakerThreshold := defaultBreakerThreshold
+	breakerCooldown := defaultBreakerCooldown
+	requireFIPS := defaultRequireFIPS
+	emfNamespace := defaultEMFNamespace
+	emfInvokeMetrics := defaultEMFInvokeMetrics
+	bundleStalenessSLA := defaultBundleStalenessSLA
+	bundleStalenessAction := defaultBundleStalenessAction
+	logLevel := defaultLogLevel
+	logRateLimit := defaultLogRateLimit
+	maintenanceBudget := defaultMaintenanceBudget
+	maintenanceInterval := defaultMaintenanceInterval
 	return Config{
 		MinimumTriggerThreshold: &minimumTriggerThreshold,
 		TriggerTimeout:          &triggerTimeout,
+		TriggerStrategy:         &triggerStrategy,
+		TriggerInvokeCount:      &triggerInvokeCount,
+		TimeBasis:               &timeBasis,
 		PluginStartPriority:     &pluginStartPriority,
+		ParallelStart:           &parallelStart,
+		PluginStartDependencies: defaultPluginStartDependencies,
 		PluginStopPriority:      &pluginStopPriority,
+		WatchdogTimeout:         &watchdogTimeout,
+		ExtensionMode:           &extensionMode,
+		InitTimeout:             &initTimeout,
+		InitTimeoutBehavior:     &initTimeoutBehavior,
+		InlineBundle:            &inlineBundle,
+		RunPolicyTests:          &runPolicyTests,
+		DiagnosticsAddr:         &diagnosticsAddr,
+		EnablePprof:             &enablePprof,
+		JournalPath:             &journalPath,
+		JournalSize:             &journalSize,
+		CrashLoopThreshold:      &crashLoopThreshold,
+		BreakerThreshold:        &breakerThreshold,
+		BreakerCooldown:         &breakerCooldown,
+		Retry:                   defaultRetryConfig(),
+		RequireFIPS:             &requireFIPS,
+		EMFNamespace:            &emfNamespace,
+		EMFInvokeMetrics:        &emfInvokeMetrics,
+		BundleStalenessSLA:      &bundleStalenessSLA,
+		BundleStalenessAction:   &bundleStalenessAction,
+		LogLevel:                &logLevel,
+		LogRateLimit:            &logRateLimit,
+		MaintenanceBudget:       &maintenanceBudget,
+		MaintenanceInterval:     &maintenanceInterval,
 	}
 }
 
+func (c *Config) newTriggerStrategy() (TriggerStrategy, error) {
+	threshold := time.Duration(*c.MinimumTriggerThreshold) * time.Second
+	return NewTriggerStrategy(*c.TriggerStrategy, threshold, *c.TriggerInvokeCount)
+}
+
+func (c *TriggerConfig) newTriggerStrategy() (TriggerStrategy, error) {
+	threshold := time.Duration(*c.MinimumThreshold) * time.Second
+	return NewTriggerStrategy(*c.Strategy, threshold, *c.InvokeCount)
+}
+
 // New creates a new instances of the lambda extension plugin.
 func (p *PluginFactory) New(manager *plugins.Manager, config interface{}) plugins.Plugin {
 	parsedConfig := defaultConfig()
 	if config != nil {
 		parsedConfig = *config.(*Config)
 	}
-	logger := manager.Logger().WithFields(map[string]interface{}{"plugin": Name})
+	recent := newRecentErrors(recentErrorsSize)
+	sandbox := newSandbox(time.Now())
+	journal := newJournal(*parsedConfig.JournalPath, *parsedConfig.JournalSize, sandbox.id)
+	pluginLogger := newPluginLogger(manager.Logger(), *parsedConfig.LogLevel, *parsedConfig.LogRateLimit)
+	logger := (&errorRecordingLogger{Logger: pluginLogger, errors: recent, journal: journal}).WithFields(map[string]interface{}{"plugin": Name, "sandbox_id": sandbox.id})
+
+	triggerStrategy, err := parsedConfig.newTriggerStrategy()
+	if err != nil {
+		logger.Error("Invalid trigger strategy, falling back to %s, %v", defaultTriggerStrategy, err)
+		triggerStrategy = &intervalTriggerStrategy{threshold: time.Duration(defaultMinimumTriggerThreshold) * time.Second}
+	}
+	pin, err := parseRevisionPin(os.Getenv(revisionPinEnvVar))
+	if err != nil {
+		logger.Error("Invalid revision pin, bundles are not pinned, %v", err)
+	}
+	pluginTriggerStrategies := map[string]TriggerStrategy{}
+	for pluginName, trigger := range parsedConfig.Triggers {
+		strategy, err := trigger.newTriggerStrategy()
+		if err != nil {
+			logger.Error("Invalid trigger strategy for plugin %s, using the top level strategy, %v", pluginName, err)
+			continue
+		}
+		pluginTriggerStrategies[pluginName] = strategy
+	}
+	maintenance := newMaintenanceScheduler(maintenanceTasks(journal), time.Duration(*parsedConfig.MaintenanceInterval)*time.Second,
+		time.Duration(*parsedConfig.MaintenanceBudget)*time.Millisecond)
 
 	plugin := &Plugin{
-		manager: manager,
-		config:  parsedConfig,
-		stop:    make(chan chan struct{}),
-		logger:  logger,
-		client:  NewClient(os.Getenv("AWS_LAMBDA_RUNTIME_API")),
+		manager:                 manager,
+		config:                  parsedConfig,
+		stop:                    make(chan chan struct{}),
+		done:                    make(chan struct{}),
+		ready:                   make(chan struct{}),
+		failedOpen:              make(chan struct{}),
+		logger:                  logger,
+		client:                  NewClient(os.Getenv("AWS_LAMBDA_RUNTIME_API")),
+		metrics:                 metrics.New(),
+		recentErrors:            recent,
+		journal:                 journal,
+		sandbox:                 sandbox,
+		emf:                     newEMFWriter(*parsedConfig.EMFNamespace, sandbox.id),
+		staleness:               newStalenessMonitor(time.Now()),
+		revisionPin:             pin,
+		breakers:                newCircuitBreakers(*parsedConfig.BreakerThreshold, time.Duration(*parsedConfig.BreakerCooldown)*time.Second),
+		triggerStrategy:         triggerStrategy,
+		pluginTriggerStrategies: pluginTriggerStrategies,
+		clock:                   newFreezeAwareClock(time.Now()),
+		maintenance:             maintenance,
 	}
+	plugin.watchdog = newWatchdog(plugin.watchdogExpired)
 
 	manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
 
@@ -146,72 +715,295 @@ type Plugin struct {
 	manager         *plugins.Manager
 	config          Config
 	stop            chan chan struct{}
+	done            chan struct{} // closed when the loop exits
+	loopErr         error         // the error that made the loop exit, set before done is closed
+	ready           chan struct{} // closed when initialization completes
+	failedOpen      chan struct{} // closed when the init timeout elapsed and the extension failed open
 	logger          logging.Logger
 	client          *Client
-	lastTriggerTime time.Time
+	watchdog        *watchdog
+	reregistrations int
+	triggerStrategy TriggerStrategy
+	cancelLoop      context.CancelFunc
+	decisionIDs     decisionIDFactory
+	metrics         metrics.Metrics
+	recentErrors    *recentErrors
+	journal         *journal
+	sandbox         *sandbox
+	breakers        *circuitBreakers
+	emf             *emfWriter
+	lastUsage       resourceUsage
+	staleness       *stalenessMonitor
+	revisionPin     *revisionPin
+	maintenance     *maintenanceScheduler
+	// whether the bundle status listener that emits bundle metrics has been registered
+	bundleListenerRegistered bool
+	// diagnostics listener and SIGUSR1 handler
+	diagnosticsServer *http.Server
+	stopDumpSignal    func()
+	// trigger strategies that override triggerStrategy for individual plugins
+	pluginTriggerStrategies map[string]TriggerStrategy
+	// tracks the time the extension spent handling events, for the warm time basis
+	clock *freezeAwareClock
+}
+
+// Lookup returns the lambda extension plugin registered with the manager.
+func Lookup(manager *plugins.Manager) *Plugin {
+	if p := manager.Plugin(Name); p != nil {
+		return p.(*Plugin)
+	}
+	return nil
 }
 
 // Start starts the plugin.
 func (p *Plugin) Start(ctx context.Context) error {
 	p.logger.Info("Starting %s.", Name)
-	res, err := p.client.Register(ctx, extensionName)
+	previous, err := p.journal.load()
+	if err != nil {
+		p.logger.Warn("Failed to read journal, %v", err)
+	}
+	p.logJournal("Journal from a previous start", previous)
+	p.recordJournal(journalStart, "")
+	p.degradeAfterCrashLoop(previous)
+	p.sandboxCreated()
+	if err := writeBuildInfo(os.Stdout); err != nil {
+		p.logger.Warn("Failed to write build info, %v", err)
+	}
+	if p.config.FaultInjection != nil {
+		p.logger.Warn("Fault injection is enabled, this configuration must not be used in production.")
+	}
+	res, err := p.register(ctx)
 	p.logger.Debug("Registered extension, %v", res)
 	if err != nil {
 		return err
 	}
+	p.recordJournal(journalRegister, res.FunctionName)
+	p.addLabels(res.AccountID)
+	if err := p.storeAccountID(ctx, res.AccountID); err != nil {
+		p.logger.Warn("Failed to write the account ID to the store, %v", err)
+	}
+	if *p.config.RequireFIPS && !profiles.Current().FIPS {
+		p.logger.Error("FIPS mode is required, but the extension was not built for FIPS mode.")
+		p.failInit(ctx, fipsErrorType)
+		return fmt.Errorf("FIPS mode is not available")
+	}
+	if err := p.loadPolicies(ctx); err != nil {
+		p.logger.Error("Failed to load inline policies, %v", err)
+		p.failInit(ctx, invalidPolicyErrorType)
+		return err
+	}
+	if err := p.activateInlineBundle(ctx); err != nil {
+		p.logger.Error("Failed to activate the inline bundle, %v", err)
+		p.failInit(ctx, invalidPolicyErrorType)
+		return err
+	}
+	if err := p.startDiagnostics(); err != nil {
+		p.logger.Error("Failed to start diagnostics, %v", err)
+		p.failInit(ctx, diagnosticsErrorType)
+		return err
+	}
+	p.registerBundleListener()
+	if *p.config.EMFInvokeMetrics {
+		p.lastUsage = readResourceUsage()
+	}
+	loopCtx, cancel := context.WithCancel(context.Background())
+	p.cancelLoop = cancel
 	// Most of the initialization needs to be done in a goroutine because the plugin manager must
 	// finish starting all the plugins before the server is initialized, and the server must be
 	// initialized before the Lambda Service is called for the first event. Plugin state must also
 	// be set to OK for the server to initialize.
 	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateOK})
+	go p.initialize(ctx)
 	go func() {
-		p.triggerPlugins(ctx, *p.config.PluginStartPriority)
-		// Wait for OPA server to fully initialize before starting the loop
-		<-p.manager.ServerInitializedChannel()
+		if !p.awaitReady(ctx) {
+			return
+		}
+		// Wait for OPA server to fully initialize before starting the loop. Internal extensions
+		// share the manager with the function, which doesn't run the OPA server.
+		if !p.internal() {
+			<-p.manager.ServerInitializedChannel()
+		}
 		// When loop starts, plugin signals to lambda that is is ready for events, so all
 		// OPA initialization should be complete by this point
-		p.loop()
+		p.loop(loopCtx)
 	}()
 	return nil
 }
 
+// initialize does the work that has to be done before the extension is ready to handle events,
+// and closes the ready channel when it's done.
+func (p *Plugin) initialize(ctx context.Context) {
+	p.startPlugins(ctx)
+	if *p.config.RunPolicyTests {
+		failures, err := p.runPolicyTests(ctx)
+		if err != nil {
+			p.logger.Error("Failed to run policy tests, %v", err)
+			p.initFailed(ctx, policyTestErrorType)
+			return
+		}
+		if len(failures) > 0 {
+			p.logger.Error("Policy tests did not pass: %v", failures)
+			p.initFailed(ctx, policyTestErrorType)
+			return
+		}
+	}
+	p.recordJournal(journalReady, "")
+	close(p.ready)
+}
+
+// initFailed fails init, unless the extension already failed open and asked for events, in which
+// case the init phase of the function is over and Lambda no longer accepts an init error, so it
+// reports an exit error and exits instead.
+func (p *Plugin) initFailed(ctx context.Context, errorType string) {
+	select {
+	case <-p.failedOpen:
+		p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateErr})
+		p.reportExitError(ctx, errorType)
+		exit(1)
+	default:
+		p.failInit(ctx, errorType)
+	}
+}
+
+// awaitReady waits for initialization to complete before the extension asks for the first event.
+// If the init timeout elapses first, the init timeout behavior decides whether to keep waiting,
+// to start handling events anyway, or to fail init. It returns false if init failed.
+func (p *Plugin) awaitReady(ctx context.Context) bool {
+	timeout := time.Duration(*p.config.InitTimeout) * time.Second
+	if timeout <= 0 {
+		<-p.ready
+		return true
+	}
+	select {
+	case <-p.ready:
+		return true
+	case <-time.After(timeout):
+	}
+	switch *p.config.InitTimeoutBehavior {
+	case FailOpenInitTimeoutBehavior:
+		p.logger.Warn("Initialization did not complete within %v, handling events while it continues.", timeout)
+		close(p.failedOpen)
+		return true
+	case FailClosedInitTimeoutBehavior:
+		p.logger.Error("Initialization did not complete within %v.", timeout)
+		p.failInit(ctx, initTimeoutErrorType)
+		return false
+	default:
+		p.logger.Warn("Initialization did not complete within %v, waiting for it to complete.", timeout)
+		<-p.ready
+		return true
+	}
+}
+
+// isReady returns true once initialization has completed.
+func (p *Plugin) isReady() bool {
+	select {
+	case <-p.ready:
+		return true
+	default:
+		return false
+	}
+}
+
 // Stop stops the plugin.
 func (p *Plugin) Stop(ctx context.Context) {
 	p.logger.Info("Stopping %s.", Name)
-	done := make(chan struct{})
-	p.stop <- done
-	<-done
+	if p.internal() {
+		// The loop of an internal extension spends most of its time blocked on the next event, and
+		// the function process is going away anyway, so don't wait for it.
+		if p.cancelLoop != nil {
+			p.cancelLoop()
+		}
+	} else {
+		// The loop may already have exited, after a shutdown event or an error
+		done := make(chan struct{})
+		select {
+		case p.stop <- done:
+			<-done
+		case <-p.done:
+		}
+	}
+	p.stopDiagnostics(ctx)
 	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
 }
 
+// NextDecisionID returns an ID for a decision that is derived from the request ID of the current
+// lambda invoke. It can be passed to the OPA server with server.WithDecisionIDFactory in custom
+// builds that construct the server themselves. The function and the extension receive the invoke
+// at the same time, so a decision made at the very beginning of an invoke could race with the
+// extension and get an ID derived from the previous request ID.
+func (p *Plugin) NextDecisionID() string {
+	return p.decisionIDs.next()
+}
+
+// Metrics returns the metrics that the plugin records about the overhead of the extension.
+func (p *Plugin) Metrics() metrics.Metrics {
+	return p.metrics
+}
+
+// Flush triggers the plugins that buffer data, i.e. status and decision_logs, in the order of
+// the plugin stop priority. External extensions do this automatically when Lambda shuts down the
+// environment, but internal extensions never receive the shutdown event, so a function that runs
+// the plugin in an internal extension should call Flush before the manager is stopped.
+func (p *Plugin) Flush(ctx context.Context) {
+	tCtx, cancel := context.WithTimeout(ctx, time.Duration(*p.config.TriggerTimeout)*time.Second)
+	defer cancel()
+	for _, pluginName := range *p.config.PluginStopPriority {
+		if pluginName == "status" || pluginName == "decision_logs" {
+			p.flushPlugin(tCtx, pluginName)
+		}
+	}
+}
+
 // Reconfigure does nothing for this plugin.
 func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 	// no-op
 }
 
-func (p *Plugin) loop() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+func (p *Plugin) loop(ctx context.Context) {
+	defer close(p.done)
+	defer p.cancelLoop()
 	for {
 		select {
 		case done := <-p.stop:
 			done <- struct{}{}
 			return
 		default:
-			// Tell the lambda service that the extension is ready for the next event
-			res, err := p.client.NextEvent(ctx)
+			// Tell the lambda service that the extension is ready for the next event. The execution
+			// environment may be frozen while the extension waits, so warm time stops, at the latest
+			// at the deadline of the last event.
+			p.clock.waiting(time.Now())
+			res, err := p.nextEvent(ctx)
 
 			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if p.reregister(ctx, err) {
+					continue
+				}
 				p.logger.Error("Extension failed to get next event, %v", err)
+				p.loopErr = err
 				return
 			}
+			p.reregistrations = 0
 
 			p.logger.Debug("Received event, %v", res)
+			received := time.Now()
+			p.clock.event(received, res.deadline())
+
+			// Everything from here until the next call to NextEvent must finish before the
+			// watchdog expires
+			p.watchdog.arm(res, p.watchdogTimeout(res))
 
 			// Shutdown event happens once, when Lambda is destroying the lambda instance. No further
 			// events will be received after this one.
 			if res.EventType == Shutdown {
 				p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
+				p.recordJournal(journalShutdown, res.ShutdownReason)
+				p.sandboxShutdown(res.ShutdownReason)
+				p.invokeFailed(ctx, res.ShutdownReason)
+				p.injectShutdownDelay()
 				tCtx, cancel := context.WithTimeout(ctx, time.Duration(*p.config.TriggerTimeout)*time.Second)
 				defer cancel()
 				// When Lambda is shutting down an instance, this extension has ~2 seconds to complete
@@ -222,27 +1014,263 @@ func (p *Plugin) loop() {
 					// updates and decision logs, because stopping these plugins does not do this
 					// automatically.
 					if pluginName == "status" || pluginName == "decision_logs" {
-						p.triggerPlugin(tCtx, pluginName)
+						p.flushPlugin(tCtx, pluginName)
 					}
 					plugin := p.manager.Plugin(pluginName)
 					if plugin != nil {
 						plugin.Stop(tCtx)
 					}
 				}
+				p.watchdog.disarm()
+				p.metrics.Histogram(shutdownOverheadMetric).Update(time.Since(received).Nanoseconds())
+				p.logger.WithFields(map[string]interface{}{"metrics": p.metrics.All()}).Info("Extension metrics at shutdown.")
 				return
 			} else {
-				// If the minimum trigger threshold has elapsed, then trigger all the plugins
-				if time.Since(p.lastTriggerTime).Seconds() > float64(*p.config.MinimumTriggerThreshold) {
-					p.lastTriggerTime = time.Now()
-					p.triggerAllPlugins(ctx)
+				p.decisionIDs.invoke(res.RequestID)
+				p.sandbox.invoke()
+				p.recordInvokeJournal(res.RequestID)
+				// Trigger the plugins whose trigger strategy says it's time. Until initialization
+				// completes, which only happens with the fail_open init timeout behavior, the
+				// plugins are still being started, so they are left alone.
+				if p.isReady() {
+					p.registerBundleListener()
+					p.triggerPlugins(ctx, p.pluginsToTrigger(time.Now()))
+					p.checkStaleness(ctx)
+				} else {
+					p.logger.Debug("Initialization has not completed, skipping triggers.")
 				}
+				p.watchdog.disarm()
+				// Maintenance runs once the watchdog is disarmed, so it can't make the watchdog
+				// report an invoke as stuck.
+				if p.isReady() {
+					p.runMaintenance(ctx)
+				}
+				overhead := time.Since(received)
+				p.metrics.Histogram(invokeOverheadMetric).Update(overhead.Nanoseconds())
+				p.logger.Debug("Handled invoke for request %q in %v.", res.RequestID, overhead)
+				p.emitInvokeUsage(overhead)
 			}
 		}
 	}
 }
 
-func (p *Plugin) triggerAllPlugins(ctx context.Context) {
-	p.triggerPlugins(ctx, p.manager.Plugins())
+func (p *Plugin) internal() bool {
+	return *p.config.ExtensionMode == InternalMode
+}
+
+// events returns the events that the extension registers for. Internal extensions are not
+// allowed to register for shutdown events.
+func (p *Plugin) events() []EventType {
+	if p.internal() {
+		return []EventType{Invoke}
+	}
+	return []EventType{Invoke, Shutdown}
+}
+
+// watchdogTimeout returns how long the extension has to handle an event. The configured timeout
+// is capped by the deadline that the Lambda service sent with the event, but never below the
+// trigger timeout, so a trigger that runs past the deadline times out on its own rather than
+// making the watchdog exit the extension.
+func (p *Plugin) watchdogTimeout(event *NextEventResponse) time.Duration {
+	timeout := time.Duration(*p.config.WatchdogTimeout) * time.Second
+	if timeout <= 0 {
+		return 0
+	}
+	if deadline := event.deadline(); !deadline.IsZero() {
+		limit := time.Until(deadline)
+		if triggerTimeout := time.Duration(*p.config.TriggerTimeout) * time.Second; limit < triggerTimeout {
+			limit = triggerTimeout
+		}
+		if limit < timeout {
+			timeout = limit
+		}
+	}
+	return timeout
+}
+
+// watchdogExpired is called when an event was not handled in time. The extension dumps what
+// it knows about its state, reports the failure to the Lambda service, and exits, which is
+// better than sitting idle until Lambda kills the environment.
+func (p *Plugin) watchdogExpired(event *NextEventResponse, elapsed time.Duration) {
+	p.logger.Error("Watchdog expired after %v while handling %s event for request %q, plugin states: %v, goroutines:\n%s",
+		elapsed, event.EventType, event.RequestID, p.pluginStates(), goroutineStacks())
+
+	p.reportExitError(context.Background(), watchdogErrorType)
+	exit(1)
+}
+
+// reregister attempts to recover when the Extensions API rejects the extension identifier by
+// registering the extension again. Lambda only permits registration while the environment is
+// initializing, so if registration fails, the extension reports an exit error and exits instead of
+// polling forever with an identifier that will never be accepted. It returns true if the extension
+// was registered again and should go back to polling for events.
+func (p *Plugin) reregister(ctx context.Context, err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.InvalidExtensionID() {
+		return false
+	}
+	if p.reregistrations >= maxReregistrations {
+		p.logger.Error("Extension identifier was rejected after %d re-registrations.", p.reregistrations)
+		p.reportExitError(ctx, invalidIDErrorType)
+		exit(1)
+		return false
+	}
+	p.reregistrations++
+	p.logger.Warn("Extension identifier was rejected, registering again, %v", err)
+	res, err := p.register(ctx)
+	if err != nil {
+		p.logger.Error("Extension failed to register again, %v", err)
+		p.reportExitError(ctx, invalidIDErrorType)
+		exit(1)
+		return false
+	}
+	p.logger.Debug("Registered extension, %v", res)
+	p.recordJournal(journalRegister, res.FunctionName)
+	return true
+}
+
+// register registers the extension with the Extensions API, retrying as the retry policy allows.
+func (p *Plugin) register(ctx context.Context) (res *RegisterResponse, err error) {
+	err = p.retry(ctx, extensionsAPIRetryComponent, classifyAPIError, func() error {
+		res, err = p.client.Register(ctx, extensionName, p.events()...)
+		return err
+	})
+	return res, err
+}
+
+// addLabels adds the account ID from the register response, the version of the extension, and
+// the configured labels, to the labels of the OPA instance, so decision logs and status updates
+// can be attributed to an account, function, or build. The plugins that report labels are only
+// triggered after registration, so the labels aren't read concurrently. Labels from the OPA
+// configuration take precedence.
+func (p *Plugin) addLabels(accountID string) {
+	labels := map[string]string{extensionVersionLabel: profiles.Build().Version}
+	if accountID != "" {
+		labels[accountIDLabel] = accountID
+	}
+	arn := functionARNFromEnvironment(accountID)
+	for name, label := range p.config.Labels {
+		value, err := expandTemplate(label, arn)
+		if err != nil {
+			p.logger.Error("Failed to expand label %s, %v", name, err)
+			continue
+		}
+		labels[name] = value
+	}
+	if p.manager.Config.Labels == nil {
+		p.manager.Config.Labels = map[string]string{}
+	}
+	for name, label := range labels {
+		if _, ok := p.manager.Config.Labels[name]; !ok {
+			p.manager.Config.Labels[name] = label
+		}
+	}
+}
+
+// storeAccountID writes the account ID from the register response to the store, so policies can
+// read it as data.lambda_extension.account_id. It's written before the plugins are started, so
+// bundles whose roots include lambda_extension, or that have no roots, replace it when they're
+// activated.
+func (p *Plugin) storeAccountID(ctx context.Context, accountID string) error {
+	if accountID == "" {
+		return nil
+	}
+	return storage.Txn(ctx, p.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		value := map[string]interface{}{"account_id": accountID}
+		return p.manager.Store.Write(ctx, txn, storage.AddOp, storage.MustParsePath(accountIDDataPath), value)
+	})
+}
+
+// nextEvent asks the Extensions API for the next event, retrying as the retry policy allows.
+func (p *Plugin) nextEvent(ctx context.Context) (res *NextEventResponse, err error) {
+	err = p.retry(ctx, extensionsAPIRetryComponent, classifyAPIError, func() error {
+		res, err = p.client.NextEvent(ctx)
+		return err
+	})
+	return res, err
+}
+
+// failInit reports an init error to the Lambda service and exits. Lambda then fails the init phase
+// of the function instead of sending it invokes.
+func (p *Plugin) failInit(ctx context.Context, errorType string) {
+	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateErr})
+	p.recordJournal(journalInitError, errorType)
+	p.logJournal("Journal", p.journal.all())
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	err := p.retry(ctx, extensionsAPIRetryComponent, classifyAPIError, func() error {
+		_, err := p.client.InitError(ctx, errorType)
+		return err
+	})
+	if err != nil {
+		p.logger.Error("Failed to report init error, %v", err)
+	}
+	exit(1)
+}
+
+// reportExitError tells the Lambda service that the extension is about to exit because of an error.
+func (p *Plugin) reportExitError(ctx context.Context, errorType string) {
+	p.recordJournal(journalExitError, errorType)
+	p.logJournal("Journal", p.journal.all())
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	err := p.retry(ctx, extensionsAPIRetryComponent, classifyAPIError, func() error {
+		_, err := p.client.ExitError(ctx, errorType)
+		return err
+	})
+	if err != nil {
+		p.logger.Error("Failed to report exit error, %v", err)
+	}
+}
+
+// pluginsToTrigger consults the trigger strategies about an invoke and returns the names of the
+// plugins that should be triggered. Every strategy is consulted exactly once per invoke.
+func (p *Plugin) pluginsToTrigger(now time.Time) []string {
+	triggerAll := p.triggerStrategy.ShouldTrigger(p.clock.now(*p.config.TimeBasis, now))
+	pluginNames := []string{}
+	for _, pluginName := range p.manager.Plugins() {
+		if pluginName == bundle.Name && p.revisionPin != nil && p.revisionPin.holds(p.configuredBundles()) {
+			// the pinned revisions are active, so no other revision may be downloaded
+			continue
+		}
+		if strategy, ok := p.pluginTriggerStrategies[pluginName]; ok {
+			if strategy.ShouldTrigger(p.pluginTime(pluginName, now)) {
+				pluginNames = append(pluginNames, pluginName)
+			}
+		} else if triggerAll {
+			pluginNames = append(pluginNames, pluginName)
+		}
+	}
+	return pluginNames
+}
+
+// startPlugins triggers the plugins in the plugin start priority, either one by one in order or
+// in parallel as their dependencies allow.
+func (p *Plugin) startPlugins(ctx context.Context) {
+	if !*p.config.ParallelStart {
+		p.triggerPlugins(ctx, *p.config.PluginStartPriority)
+		return
+	}
+	tasks := []initTask{}
+	for _, pluginName := range *p.config.PluginStartPriority {
+		pluginName := pluginName
+		tasks = append(tasks, initTask{
+			name: pluginName,
+			deps: p.config.PluginStartDependencies[pluginName],
+			run: func(ctx context.Context) {
+				p.triggerPlugin(ctx, pluginName)
+			},
+		})
+	}
+	started := time.Now()
+	tCtx, cancel := context.WithTimeout(ctx, time.Duration(*p.config.TriggerTimeout)*time.Second)
+	defer cancel()
+	if err := runInitTasks(tCtx, tasks); err != nil {
+		p.logger.Error("Failed to start plugins in parallel, starting them in order, %v", err)
+		p.triggerPlugins(ctx, *p.config.PluginStartPriority)
+		return
+	}
+	p.logger.Debug("Started plugins in parallel in %v.", time.Since(started))
 }
 
 func (p *Plugin) triggerPlugins(ctx context.Context, pluginNames []string) {
@@ -253,7 +1281,18 @@ func (p *Plugin) triggerPlugins(ctx context.Context, pluginNames []string) {
 	}
 }
 
+// triggerPlugin triggers a plugin, unless its circuit breaker is open.
 func (p *Plugin) triggerPlugin(ctx context.Context, pluginName string) {
+	p.trigger(ctx, pluginName, false)
+}
+
+// flushPlugin triggers a plugin that buffers data, i.e. status or decision_logs, one last time.
+// Its circuit breaker is bypassed, because whatever the plugin still buffers is lost otherwise.
+func (p *Plugin) flushPlugin(ctx context.Context, pluginName string) {
+	p.trigger(ctx, pluginName, true)
+}
+
+func (p *Plugin) trigger(ctx context.Context, pluginName string, bypassBreaker bool) {
 	plugin := p.manager.Plugin(pluginName)
 	if plugin == nil {
 		return
@@ -262,12 +1301,31 @@ func (p *Plugin) triggerPlugin(ctx context.Context, pluginName string) {
 	if !ok {
 		return
 	}
-	err := triggerable.Trigger(ctx)
+	trigger := func() error {
+		return p.retry(ctx, pluginName, classifyPluginError, func() error {
+			if err := p.injectTriggerFault(ctx, pluginName); err != nil {
+				return err
+			}
+			return triggerable.Trigger(ctx)
+		})
+	}
+	if p.breakers == nil {
+		if err := trigger(); err != nil {
+			p.logger.Error("Error while triggering plugin: %s, %v", pluginName, err)
+		}
+		return
+	}
+	breaker := p.breakers.get(pluginName)
+	if !bypassBreaker && !breaker.allow(p.pluginTime(pluginName, time.Now())) {
+		p.logger.Debug("Circuit breaker for plugin %s is open, skipping trigger.", pluginName)
+		return
+	}
+	err := trigger()
 	if err != nil {
 		p.logger.Error("Error while triggering plugin: %s, %v", pluginName, err)
 	}
-}
-
-func init() {
-	runtime.RegisterPlugin(Name, &PluginFactory{})
+	previous := breaker.currentState()
+	if state := breaker.record(p.pluginTime(pluginName, time.Now()), err); state != previous {
+		p.logger.Warn("Circuit breaker for plugin %s is %s.", pluginName, state)
+	}
 }
@@ -37,13 +37,74 @@ func TestPluginFactoryValidate(t *testing.T) {
 	factory := PluginFactory{}
 	c, err := factory.Validate(manager, []byte(`{
     "minimum_trigger_threshold": 100,
+    "trigger_strategy": "every_n_invokes",
+    "trigger_invoke_count": 5,
+    "time_basis": "warm",
+    "triggers": {
+      "bundle": {
+        "invoke_count": 50
+      },
+      "status": {
+        "strategy": "interval",
+        "minimum_threshold": 300,
+        "time_basis": "wall"
+      }
+    },
     "plugin_start_priority": [
       "foo"
     ],
+    "parallel_start": true,
+    "plugin_start_dependencies": {
+      "bar": ["foo"]
+    },
     "plugin_stop_priority": [
       "bar"
     ],
-    trigger_timeout: 50
+    trigger_timeout: 50,
+    watchdog_timeout: 20,
+    extension_mode: "internal",
+    init_timeout: 8,
+    init_timeout_behavior: "fail_open",
+    policies: {
+      "authz.rego": "package authz\n\ndefault allow = false\n"
+    },
+    run_policy_tests: true,
+    diagnostics_addr: "localhost:8182",
+    enable_pprof: true,
+    journal_path: "/tmp/journal",
+    journal_size: 50,
+    crash_loop_threshold: 5,
+    breaker_threshold: 3,
+    breaker_cooldown: 120,
+    retry: {
+      max_attempts: 3,
+      retry_on: ["network", "server_error"]
+    },
+    retries: {
+      bundle: {
+        max_attempts: 2,
+        initial_backoff_ms: 500
+      }
+    },
+    require_fips: true,
+    emf_namespace: "OPA",
+    emf_invoke_metrics: false,
+    bundle_staleness_sla: 600,
+    bundle_staleness_action: "fail_closed",
+    log_level: "debug",
+    log_rate_limit: 10,
+    maintenance_budget_ms: 20,
+    maintenance_interval: 300,
+    labels: {
+      "function": "{function}:{qualifier}"
+    },
+    fault_injection: {
+      plugins: {
+        decision_logs: {
+          failure_percent: 50
+        }
+      }
+    }
   }`))
 	if err != nil {
 		t.Fatal(err)
@@ -55,18 +116,136 @@ func TestPluginFactoryValidate(t *testing.T) {
 	expectedConfig := &Config{
 		MinimumTriggerThreshold: getIntPointer(100),
 		TriggerTimeout:          getIntPointer(50),
+		TriggerStrategy:         getStringPointer("every_n_invokes"),
+		TriggerInvokeCount:      getIntPointer(5),
+		TimeBasis:               getStringPointer("warm"),
+		Triggers: map[string]*TriggerConfig{
+			"bundle": {
+				Strategy:         getStringPointer("every_n_invokes"),
+				MinimumThreshold: getIntPointer(100),
+				InvokeCount:      getIntPointer(50),
+				TimeBasis:        getStringPointer("warm"),
+			},
+			"status": {
+				Strategy:         getStringPointer("interval"),
+				MinimumThreshold: getIntPointer(300),
+				InvokeCount:      getIntPointer(5),
+				TimeBasis:        getStringPointer("wall"),
+			},
+		},
 		PluginStartPriority: &[]string{
 			"foo",
 		},
+		ParallelStart: getBoolPointer(true),
+		PluginStartDependencies: map[string][]string{
+			"bar": {"foo"},
+		},
 		PluginStopPriority: &[]string{
 			"bar",
 		},
+		WatchdogTimeout:     getIntPointer(20),
+		ExtensionMode:       getStringPointer("internal"),
+		InitTimeout:         getIntPointer(8),
+		InitTimeoutBehavior: getStringPointer("fail_open"),
+		Policies: map[string]string{
+			"authz.rego": "package authz\n\ndefault allow = false\n",
+		},
+		InlineBundle:       getStringPointer(""),
+		RunPolicyTests:     getBoolPointer(true),
+		DiagnosticsAddr:    getStringPointer("localhost:8182"),
+		EnablePprof:        getBoolPointer(true),
+		JournalPath:        getStringPointer("/tmp/journal"),
+		JournalSize:        getIntPointer(50),
+		CrashLoopThreshold: getIntPointer(5),
+		BreakerThreshold:   getIntPointer(3),
+		BreakerCooldown:    getIntPointer(120),
+		Retry: &RetryConfig{
+			MaxAttempts:    getIntPointer(3),
+			InitialBackoff: getIntPointer(100),
+			MaxBackoff:     getIntPointer(1000),
+			MaxElapsed:     getIntPointer(0),
+			RetryOn:        &[]string{"network", "server_error"},
+		},
+		Retries: map[string]*RetryConfig{
+			"bundle": {
+				MaxAttempts:    getIntPointer(2),
+				InitialBackoff: getIntPointer(500),
+				MaxBackoff:     getIntPointer(1000),
+				MaxElapsed:     getIntPointer(0),
+				RetryOn:        &[]string{"network", "server_error"},
+			},
+		},
+		RequireFIPS:           getBoolPointer(true),
+		EMFNamespace:          getStringPointer("OPA"),
+		EMFInvokeMetrics:      getBoolPointer(false),
+		BundleStalenessSLA:    getIntPointer(600),
+		BundleStalenessAction: getStringPointer("fail_closed"),
+		LogLevel:              getStringPointer("debug"),
+		LogRateLimit:          getIntPointer(10),
+		MaintenanceBudget:     getIntPointer(20),
+		MaintenanceInterval:   getIntPointer(300),
+		Labels: map[string]string{
+			"function": "{function}:{qualifier}",
+		},
+		FaultInjection: &FaultInjectionConfig{
+			Plugins: map[string]*PluginFaultConfig{
+				"decision_logs": {
+					FailurePercent: getIntPointer(50),
+					Delay:          getIntPointer(0),
+				},
+			},
+			ShutdownDelay: getIntPointer(0),
+		},
 	}
 	if !reflect.DeepEqual(config, expectedConfig) {
 		t.Fatalf("Expected\n%v Got\n%v", spew.Sdump(expectedConfig), spew.Sdump(config))
 	}
 }
 
+func TestPluginFactoryValidateInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "invalid extension_mode", config: `{"extension_mode": "foo"}`},
+		{name: "enable_pprof without diagnostics_addr", config: `{"enable_pprof": true}`},
+		{name: "duplicate plugin in plugin_start_priority", config: `{"plugin_start_priority": ["bundle", "bundle"], "parallel_start": true}`},
+		{name: "invalid init_timeout_behavior", config: `{"init_timeout_behavior": "foo"}`},
+		{name: "policy that doesn't parse", config: `{"policies": {"authz.rego": "package authz\nallow {"}}`},
+		{name: "inline_bundle that isn't base64", config: `{"inline_bundle": "not a bundle"}`},
+		{name: "invalid log_level", config: `{"log_level": "trace"}`},
+		{name: "unknown plugin in triggers", config: `{"triggers": {"bundles": {"invoke_count": 2}}}`},
+		{name: "unknown plugin in retries", config: `{"retries": {"decision_log": {"max_attempts": 2}}}`},
+		{name: "unknown plugin in fault_injection", config: `{"fault_injection": {"plugins": {"statuss": {"failure_percent": 50}}}}`},
+		{name: "failure percent above 100", config: `{"fault_injection": {"plugins": {"bundle": {"failure_percent": 101}}}}`},
+		{name: "emf_invoke_metrics in internal mode", config: `{"extension_mode": "internal", "emf_namespace": "opa", "emf_invoke_metrics": true}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			manager, err := plugins.New(nil, "test", inmem.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+			factory := PluginFactory{}
+			if _, err := factory.Validate(manager, []byte(tc.config)); err == nil {
+				t.Fatalf("Expected an error for %s", tc.name)
+			}
+		})
+	}
+}
+
+func TestPluginFactoryValidateConfiguredPluginName(t *testing.T) {
+	manager, err := plugins.New([]byte(`{"plugins": {"custom": {}}}`), "test", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := PluginFactory{}
+	config := `{"triggers": {"custom": {"invoke_count": 2}}, "retries": {"custom": {"max_attempts": 2}}}`
+	if _, err := factory.Validate(manager, []byte(config)); err != nil {
+		t.Fatalf("Expected a plugin in the plugins section to be accepted, got %v", err)
+	}
+}
+
 func TestPluginFactoryValidateDefaults(t *testing.T) {
 	manager, err := plugins.New(nil, "test", inmem.New())
 	if err != nil {
@@ -263,10 +442,32 @@ func TestPluginLifecycle(t *testing.T) {
 	}
 }
 
+// newTestPlugin validates the config and creates a plugin with a manager that has no other plugins.
+func newTestPlugin(t *testing.T, config string) *Plugin {
+	manager, err := plugins.New(nil, "test", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := PluginFactory{}
+	c, err := factory.Validate(manager, []byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return factory.New(manager, c).(*Plugin)
+}
+
 func getIntPointer(i int) *int {
 	return &i
 }
 
+func getStringPointer(s string) *string {
+	return &s
+}
+
+func getBoolPointer(b bool) *bool {
+	return &b
+}
+
 type testFixture struct {
 	ctx            context.Context
 	manager        *plugins.Manager
@@ -469,3 +670,159 @@ func (t *testFixtureServer) handle(w http.ResponseWriter, r *http.Request) {
 func (t *testFixtureServer) stop() {
 	t.server.Close()
 }
+
+func TestAddLabels(t *testing.T) {
+	os.Setenv("AWS_LAMBDA_FUNCTION_NAME", "foo")
+	defer os.Unsetenv("AWS_LAMBDA_FUNCTION_NAME")
+	p := newTestPlugin(t, `{"labels": {"prefix": "{account}/{function}"}}`)
+	p.addLabels("123456789012")
+	if label := p.manager.Labels()["aws_account_id"]; label != "123456789012" {
+		t.Fatalf("Expected the account ID label, got %q", label)
+	}
+	if label := p.manager.Labels()["prefix"]; label != "123456789012/foo" {
+		t.Fatalf("Expected the templated label, got %q", label)
+	}
+	// a label from the configuration is kept
+	p.addLabels("210987654321")
+	if label := p.manager.Labels()["aws_account_id"]; label != "123456789012" {
+		t.Fatalf("Expected the account ID label to be kept, got %q", label)
+	}
+}
+
+func TestStoreAccountID(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPlugin(t, `{}`)
+	if err := p.storeAccountID(ctx, "123456789012"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := rego.New(rego.Query("data.lambda_extension.account_id"), rego.Store(p.manager.Store)).Eval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].Expressions[0].Value != "123456789012" {
+		t.Fatalf("Expected policies to read the account ID, got %v", rs)
+	}
+}
+
+func TestLoopExitsWhenExtensionIDIsRejected(t *testing.T) {
+	registrations := 0
+	exitErrors := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-01-01/extension/register":
+			registrations++
+			w.Header().Set(extensionIdentiferHeader, "id")
+			fmt.Fprintf(w, `{"functionName": "foo", "functionVersion": "1", "handler": "bar"}`)
+		case "/2020-01-01/extension/event/next":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `{
+      "errorMessage": "Invalid extension identifier",
+      "errorType": "Extension.InvalidExtensionID"
+    }`)
+		case "/2020-01-01/extension/exit/error":
+			exitErrors = append(exitErrors, r.Header.Get(extensionErrorType))
+			fmt.Fprintf(w, `{"status": "OK"}`)
+		default:
+			t.Errorf("unexpected path sent to test server: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	p := newTestPlugin(t, `{}`)
+	p.client = NewClient(server.URL[7:])
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancelLoop = cancel
+
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	p.loop(ctx)
+
+	if code != 1 {
+		t.Fatalf("Expected the extension to exit with code 1, got %d", code)
+	}
+	if registrations != maxReregistrations {
+		t.Fatalf("Expected %d re-registrations, got %d", maxReregistrations, registrations)
+	}
+	if len(exitErrors) != 1 || exitErrors[0] != invalidIDErrorType {
+		t.Fatalf("Expected a single %s exit error, got %v", invalidIDErrorType, exitErrors)
+	}
+}
+
+// newAwaitReadyTestPlugin returns a plugin with a one second init timeout and the init timeout
+// behavior, whose initialization never completes, and records the errors it reports.
+func newAwaitReadyTestPlugin(t *testing.T, behavior string) (*Plugin, *[]string, func()) {
+	initErrors := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2020-01-01/extension/init/error" {
+			t.Errorf("unexpected path sent to test server: %s", r.URL.Path)
+			return
+		}
+		initErrors = append(initErrors, r.Header.Get(extensionErrorType))
+		fmt.Fprintf(w, `{"status": "OK"}`)
+	}))
+	p := newTestPlugin(t, fmt.Sprintf(`{"init_timeout": 1, "init_timeout_behavior": %q}`, behavior))
+	p.client = NewClient(server.URL[7:])
+	return p, &initErrors, server.Close
+}
+
+func TestAwaitReadyDelay(t *testing.T) {
+	p, initErrors, closeServer := newAwaitReadyTestPlugin(t, DelayInitTimeoutBehavior)
+	defer closeServer()
+	returned := make(chan bool)
+	go func() { returned <- p.awaitReady(context.Background()) }()
+
+	select {
+	case <-returned:
+		t.Fatal("Expected the extension to keep waiting after the init timeout")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	close(p.ready)
+	if !<-returned {
+		t.Fatal("Expected the extension to handle events once initialization completed")
+	}
+	if len(*initErrors) != 0 {
+		t.Fatalf("Expected no init errors, got %v", *initErrors)
+	}
+}
+
+func TestAwaitReadyFailOpen(t *testing.T) {
+	p, initErrors, closeServer := newAwaitReadyTestPlugin(t, FailOpenInitTimeoutBehavior)
+	defer closeServer()
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	if !p.awaitReady(context.Background()) {
+		t.Fatal("Expected the extension to handle events after the init timeout")
+	}
+	if p.isReady() {
+		t.Fatal("Expected initialization to still be incomplete")
+	}
+	select {
+	case <-p.failedOpen:
+	default:
+		t.Fatal("Expected the extension to record that it failed open")
+	}
+	if code != -1 || len(*initErrors) != 0 {
+		t.Fatalf("Expected the extension not to exit or report an init error, got %d and %v", code, *initErrors)
+	}
+}
+
+func TestAwaitReadyFailClosed(t *testing.T) {
+	p, initErrors, closeServer := newAwaitReadyTestPlugin(t, FailClosedInitTimeoutBehavior)
+	defer closeServer()
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	if p.awaitReady(context.Background()) {
+		t.Fatal("Expected the extension not to handle events after the init timeout")
+	}
+	if code != 1 {
+		t.Fatalf("Expected the extension to exit with code 1, got %d", code)
+	}
+	if !reflect.DeepEqual(*initErrors, []string{initTimeoutErrorType}) {
+		t.Fatalf("Expected a single %s init error, got %v", initTimeoutErrorType, *initErrors)
+	}
+}
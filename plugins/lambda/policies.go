@@ -0,0 +1,136 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+const invalidPolicyErrorType = "Extension.InvalidPolicy"
+
+// validatePolicies parses the inline policies, so syntax errors are reported with the rest of the
+// configuration.
+func validatePolicies(policies map[string]string) error {
+	for id, policy := range policies {
+		if _, err := ast.ParseModule(id, policy); err != nil {
+			return fmt.Errorf("invalid policy %q, %v", id, err)
+		}
+	}
+	return nil
+}
+
+// loadPolicies compiles the inline policies along with the policies already in the store, and
+// upserts them into the store if they compile. Committing the policies makes the plugin manager
+// compile the store again, which activates them. Bundles that are activated later keep the inline
+// policies, unless their packages are under the roots of a bundle.
+func (p *Plugin) loadPolicies(ctx context.Context) error {
+	if len(p.config.Policies) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(p.config.Policies))
+	for id := range p.config.Policies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return storage.Txn(ctx, p.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		modules := map[string]*ast.Module{}
+		existing, err := p.manager.Store.ListPolicies(ctx, txn)
+		if err != nil {
+			return err
+		}
+		for _, id := range existing {
+			bs, err := p.manager.Store.GetPolicy(ctx, txn, id)
+			if err != nil {
+				return err
+			}
+			module, err := ast.ParseModule(id, string(bs))
+			if err != nil {
+				return err
+			}
+			modules[id] = module
+		}
+		for _, id := range ids {
+			module, err := ast.ParseModule(id, p.config.Policies[id])
+			if err != nil {
+				return fmt.Errorf("invalid policy %q, %v", id, err)
+			}
+			modules[id] = module
+		}
+
+		compiler := ast.NewCompiler()
+		if compiler.Compile(modules); compiler.Failed() {
+			return compiler.Errors
+		}
+		for _, id := range ids {
+			if err := p.manager.Store.UpsertPolicy(ctx, txn, id, []byte(p.config.Policies[id])); err != nil {
+				return err
+			}
+		}
+		p.logger.Info("Loaded %d inline policies.", len(ids))
+		return nil
+	})
+}
+
+// inlineBundleName is the name that the inline bundle is activated as.
+const inlineBundleName = "inline"
+
+// decodeInlineBundle decodes and reads the inline bundle, so an invalid bundle is reported with
+// the rest of the configuration.
+func decodeInlineBundle(encoded string) (*bundle.Bundle, error) {
+	bs, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inline_bundle, %v", err)
+	}
+	b, err := bundle.NewReader(bytes.NewReader(bs)).Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid inline_bundle, %v", err)
+	}
+	return &b, nil
+}
+
+// activateInlineBundle activates the inline bundle the way the bundle plugin activates the bundles
+// it downloads, so its roots are checked against the other bundles and its policies are compiled
+// along with the policies already in the store.
+func (p *Plugin) activateInlineBundle(ctx context.Context) error {
+	if *p.config.InlineBundle == "" {
+		return nil
+	}
+	b, err := decodeInlineBundle(*p.config.InlineBundle)
+	if err != nil {
+		return err
+	}
+
+	params := storage.WriteParams
+	params.Context = storage.NewContext()
+	err = storage.Txn(ctx, p.manager.Store, params, func(txn storage.Transaction) error {
+		compiler := ast.NewCompiler().WithPathConflictsCheck(storage.NonEmpty(ctx, p.manager.Store, txn))
+		err := bundle.Activate(&bundle.ActivateOpts{
+			Ctx:      ctx,
+			Store:    p.manager.Store,
+			Txn:      txn,
+			TxnCtx:   params.Context,
+			Compiler: compiler,
+			Metrics:  metrics.New(),
+			Bundles:  map[string]*bundle.Bundle{inlineBundleName: b},
+		})
+		plugins.SetCompilerOnContext(params.Context, compiler)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	p.logger.Info("Activated the inline bundle with %d policies.", len(b.Modules))
+	return nil
+}
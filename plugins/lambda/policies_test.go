@@ -0,0 +1,103 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+func TestLoadPolicies(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPlugin(t, `{"policies": {"authz.rego": "package authz\n\ndefault allow = false\n"}}`)
+	if err := p.loadPolicies(ctx); err != nil {
+		t.Fatal(err)
+	}
+	txn := storage.NewTransactionOrDie(ctx, p.manager.Store)
+	defer p.manager.Store.Abort(ctx, txn)
+	ids, err := p.manager.Store.ListPolicies(ctx, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "authz.rego" {
+		t.Fatalf("Expected the inline policy in the store, got %v", ids)
+	}
+}
+
+func TestLoadPoliciesCompileError(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPlugin(t, `{"policies": {"authz.rego": "package authz\n\nallow { undefined_function(input) }\n"}}`)
+	if err := p.loadPolicies(ctx); err == nil {
+		t.Fatal("Expected an error for a policy that doesn't compile")
+	}
+	txn := storage.NewTransactionOrDie(ctx, p.manager.Store)
+	defer p.manager.Store.Abort(ctx, txn)
+	if ids, _ := p.manager.Store.ListPolicies(ctx, txn); len(ids) != 0 {
+		t.Fatalf("Expected no policies in the store, got %v", ids)
+	}
+}
+
+func encodeTestBundle(t *testing.T, policy string) string {
+	t.Helper()
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Roots: &[]string{"inline"}},
+		Data:     map[string]interface{}{"inline": map[string]interface{}{"admins": []interface{}{"alice"}}},
+		Modules:  []bundle.ModuleFile{{URL: "/authz.rego", Path: "/authz.rego", Raw: []byte(policy)}},
+	}
+	var buf bytes.Buffer
+	if err := bundle.NewWriter(&buf).Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestActivateInlineBundle(t *testing.T) {
+	ctx := context.Background()
+	encoded := encodeTestBundle(t, "package inline.authz\n\nallow { input.user == data.inline.admins[_] }\n")
+	p := newTestPlugin(t, fmt.Sprintf(`{"inline_bundle": %q, "policies": {"authz.rego": "package authz\n\ndefault allow = false\n"}}`, encoded))
+	if err := p.loadPolicies(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.activateInlineBundle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	txn := storage.NewTransactionOrDie(ctx, p.manager.Store)
+	defer p.manager.Store.Abort(ctx, txn)
+	ids, err := p.manager.Store.ListPolicies(ctx, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"authz.rego", "inline/authz.rego"}) {
+		t.Fatalf("Expected the bundle and inline policies in the store, got %v", ids)
+	}
+	if _, err := p.manager.Store.Read(ctx, txn, storage.MustParsePath("/inline/admins")); err != nil {
+		t.Fatalf("Expected the bundle data in the store, %v", err)
+	}
+	if names, err := bundle.ReadBundleNamesFromStore(ctx, p.manager.Store, txn); err != nil || len(names) != 1 || names[0] != inlineBundleName {
+		t.Fatalf("Expected the bundle to be activated as %q, got %v, %v", inlineBundleName, names, err)
+	}
+}
+
+func TestActivateInlineBundleCompileError(t *testing.T) {
+	ctx := context.Background()
+	encoded := encodeTestBundle(t, "package inline.authz\n\nallow { undefined_function(input) }\n")
+	p := newTestPlugin(t, fmt.Sprintf(`{"inline_bundle": %q}`, encoded))
+	if err := p.activateInlineBundle(ctx); err == nil {
+		t.Fatal("Expected an error for a bundle that doesn't compile")
+	}
+	txn := storage.NewTransactionOrDie(ctx, p.manager.Store)
+	defer p.manager.Store.Abort(ctx, txn)
+	if ids, _ := p.manager.Store.ListPolicies(ctx, txn); len(ids) != 0 {
+		t.Fatalf("Expected no policies in the store, got %v", ids)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build !minimal
+// +build !minimal
+
+package lambda
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/tester"
+)
+
+// runPolicyTests runs the tests, i.e. the rules prefixed with test_, that were loaded along with
+// the policies, and returns a description of every test that did not pass.
+func (p *Plugin) runPolicyTests(ctx context.Context) ([]string, error) {
+	compiler := p.manager.GetCompiler()
+	if compiler == nil {
+		return nil, nil
+	}
+	txn, err := p.manager.Store.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.manager.Store.Abort(ctx, txn)
+
+	results, err := tester.NewRunner().SetCompiler(compiler).SetStore(p.manager.Store).RunTests(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	failures := []string{}
+	passed := 0
+	for result := range results {
+		switch {
+		case result.Error != nil:
+			failures = append(failures, fmt.Sprintf("%s.%s: error: %v", result.Package, result.Name, result.Error))
+		case result.Fail:
+			failures = append(failures, fmt.Sprintf("%s.%s: fail", result.Package, result.Name))
+		default:
+			passed++
+		}
+	}
+	p.logger.Info("Ran policy tests, %d passed, %d failed.", passed, len(failures))
+	return failures, nil
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build minimal
+// +build minimal
+
+package lambda
+
+import (
+	"context"
+	"fmt"
+)
+
+// runPolicyTests returns an error in minimal builds, which leave out the Rego evaluator that the
+// tests need. Validate rejects run_policy_tests before it could be called.
+func (p *Plugin) runPolicyTests(context.Context) ([]string, error) {
+	return nil, fmt.Errorf("policy tests are not available in the minimal build profile")
+}
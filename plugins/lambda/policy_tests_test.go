@@ -0,0 +1,115 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const policyTestsModule = `package authz
+
+default allow = false
+
+allow { input.user == "admin" }
+
+conflict = 1 { true }
+conflict = 2 { true }
+
+test_admin_allowed { allow with input as {"user": "admin"} }
+test_guest_allowed { allow with input as {"user": "guest"} }
+test_conflict { conflict == 1 }
+`
+
+// newPolicyTestsPlugin returns a plugin that runs the policy tests of an inline module with a
+// test that passes, one that fails, and one that errors.
+func newPolicyTestsPlugin(t *testing.T) *Plugin {
+	ctx := context.Background()
+	config := fmt.Sprintf(`{"run_policy_tests": true, "policies": {"authz.rego": %q}}`, policyTestsModule)
+	p := newTestPlugin(t, config)
+	if err := p.manager.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.loadPolicies(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRunPolicyTests(t *testing.T) {
+	p := newPolicyTestsPlugin(t)
+	failures, err := p.runPolicyTests(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 2 {
+		t.Fatalf("Expected 2 failures, got %v", failures)
+	}
+	if failures[0] != "data.authz.test_guest_allowed: fail" {
+		t.Fatalf("Expected the failing test, got %q", failures[0])
+	}
+	if !strings.HasPrefix(failures[1], "data.authz.test_conflict: error: ") {
+		t.Fatalf("Expected the test with an error, got %q", failures[1])
+	}
+}
+
+func TestPolicyTestFailureFailsInit(t *testing.T) {
+	initErrors := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2020-01-01/extension/init/error" {
+			t.Errorf("unexpected path sent to test server: %s", r.URL.Path)
+			return
+		}
+		initErrors = append(initErrors, r.Header.Get(extensionErrorType))
+		fmt.Fprintf(w, `{"status": "OK"}`)
+	}))
+	defer server.Close()
+
+	p := newPolicyTestsPlugin(t)
+	p.client = NewClient(server.URL[7:])
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	p.initialize(context.Background())
+
+	if code != 1 {
+		t.Fatalf("Expected the extension to exit with code 1, got %d", code)
+	}
+	if !reflect.DeepEqual(initErrors, []string{policyTestErrorType}) {
+		t.Fatalf("Expected a single %s init error, got %v", policyTestErrorType, initErrors)
+	}
+	if p.isReady() {
+		t.Fatal("Expected the extension not to be ready")
+	}
+}
+
+func TestPolicyTestFailureAfterFailOpenExits(t *testing.T) {
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprintf(w, `{"status": "OK"}`)
+	}))
+	defer server.Close()
+
+	p := newPolicyTestsPlugin(t)
+	p.client = NewClient(server.URL[7:])
+	close(p.failedOpen)
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	p.initialize(context.Background())
+
+	if code != 1 {
+		t.Fatalf("Expected the extension to exit with code 1, got %d", code)
+	}
+	if !reflect.DeepEqual(paths, []string{"/2020-01-01/extension/exit/error"}) {
+		t.Fatalf("Expected an exit error rather than an init error after failing open, got %v", paths)
+	}
+}
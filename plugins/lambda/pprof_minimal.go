@@ -0,0 +1,15 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build minimal
+// +build minimal
+
+package lambda
+
+import (
+	"net/http"
+)
+
+// registerPprof does nothing in minimal builds. Validate rejects enable_pprof before it could be
+// called.
+func registerPprof(mux *http.ServeMux) {}
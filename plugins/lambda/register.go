@@ -0,0 +1,17 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build !minimal
+// +build !minimal
+
+package lambda
+
+import (
+	"github.com/open-policy-agent/opa/runtime"
+)
+
+// The OPA runtime brings in everything `opa run` needs, so minimal builds, which can only run
+// standalone, don't register the plugin with it.
+func init() {
+	runtime.RegisterPlugin(Name, &PluginFactory{})
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Retry classes, i.e. the kinds of errors that a retry policy can retry
+const (
+	// RetryOnNetwork retries Extensions API calls that failed before a response was received.
+	RetryOnNetwork = "network"
+	// RetryOnServerError retries Extensions API calls that got a 5xx response.
+	RetryOnServerError = "server_error"
+	// RetryOnThrottled retries Extensions API calls that got a 429 response.
+	RetryOnThrottled = "throttled"
+	// RetryOnPluginError retries plugin triggers that returned an error, e.g. a failed bundle
+	// download or decision log upload.
+	RetryOnPluginError = "plugin_error"
+)
+
+const (
+	defaultRetryMaxAttempts    = int(1)
+	defaultRetryInitialBackoff = int(100)
+	defaultRetryMaxBackoff     = int(1000)
+	defaultRetryMaxElapsed     = int(0)
+	// the component name of the Extensions API in the retry policy overrides
+	extensionsAPIRetryComponent = "extensions_api"
+)
+
+var defaultRetryOn = []string{RetryOnNetwork, RetryOnServerError, RetryOnThrottled, RetryOnPluginError}
+
+// RetryConfig represents a retry policy. Fields that aren't set in an override are inherited from
+// the top level retry policy.
+type RetryConfig struct {
+	// The maximum number of attempts, including the first one. A value of 1 disables retries.
+	MaxAttempts *int `json:"max_attempts,omitempty"`
+	// The time in milliseconds to wait before the first retry. The backoff doubles on every retry.
+	InitialBackoff *int `json:"initial_backoff_ms,omitempty"`
+	// The maximum time in milliseconds to wait between retries.
+	MaxBackoff *int `json:"max_backoff_ms,omitempty"`
+	// The maximum time in milliseconds from the first attempt after which no more retries are
+	// made. A value of 0 means no limit other than the timeout of the event.
+	MaxElapsed *int `json:"max_elapsed_ms,omitempty"`
+	// The classes of errors that are retried.
+	RetryOn *[]string `json:"retry_on,omitempty"`
+}
+
+func defaultRetryConfig() *RetryConfig {
+	maxAttempts := defaultRetryMaxAttempts
+	initialBackoff := defaultRetryInitialBackoff
+	maxBackoff := defaultRetryMaxBackoff
+	maxElapsed := defaultRetryMaxElapsed
+	retryOn := append([]string{}, defaultRetryOn...)
+	return &RetryConfig{
+		MaxAttempts:    &maxAttempts,
+		InitialBackoff: &initialBackoff,
+		MaxBackoff:     &maxBackoff,
+		MaxElapsed:     &maxElapsed,
+		RetryOn:        &retryOn,
+	}
+}
+
+// inherit fills the fields that aren't set from the parent policy.
+func (c *RetryConfig) inherit(parent *RetryConfig) {
+	if c.MaxAttempts == nil {
+		c.MaxAttempts = parent.MaxAttempts
+	}
+	if c.InitialBackoff == nil {
+		c.InitialBackoff = parent.InitialBackoff
+	}
+	if c.MaxBackoff == nil {
+		c.MaxBackoff = parent.MaxBackoff
+	}
+	if c.MaxElapsed == nil {
+		c.MaxElapsed = parent.MaxElapsed
+	}
+	if c.RetryOn == nil {
+		c.RetryOn = parent.RetryOn
+	}
+}
+
+func (c *RetryConfig) validate() error {
+	if *c.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts must be at least 1")
+	}
+	if *c.InitialBackoff < 0 || *c.MaxBackoff < 0 || *c.MaxElapsed < 0 {
+		return fmt.Errorf("backoff and elapsed times must not be negative")
+	}
+	for _, class := range *c.RetryOn {
+		switch class {
+		case RetryOnNetwork, RetryOnServerError, RetryOnThrottled, RetryOnPluginError:
+		default:
+			return fmt.Errorf("invalid retry class %q", class)
+		}
+	}
+	return nil
+}
+
+func (c *RetryConfig) retries(class string) bool {
+	for _, retryOn := range *c.RetryOn {
+		if retryOn == class {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPolicy returns the retry policy for a component, i.e. extensions_api or a plugin name.
+func (p *Plugin) retryPolicy(component string) *RetryConfig {
+	if policy, ok := p.config.Retries[component]; ok {
+		return policy
+	}
+	return p.config.Retry
+}
+
+// retry calls fn until it succeeds, the error isn't retryable, or the policy of the component
+// gives up, and returns the last error. The classify function returns the retry class of an
+// error, or "" if the error is never retried.
+func (p *Plugin) retry(ctx context.Context, component string, classify func(error) string, fn func() error) error {
+	policy := p.retryPolicy(component)
+	backoff := time.Duration(*policy.InitialBackoff) * time.Millisecond
+	maxBackoff := time.Duration(*policy.MaxBackoff) * time.Millisecond
+	maxElapsed := time.Duration(*policy.MaxElapsed) * time.Millisecond
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= *policy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		class := classify(err)
+		if class == "" || !policy.retries(class) {
+			return err
+		}
+		if maxElapsed > 0 && time.Since(started)+backoff > maxElapsed {
+			return err
+		}
+		p.logger.Debug("Retrying %s in %v after attempt %d failed, %v", component, backoff, attempt, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// classifyAPIError returns the retry class of an error from the Extensions API client.
+func classifyAPIError(err error) string {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return RetryOnNetwork
+	}
+	switch {
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		return RetryOnThrottled
+	case apiErr.StatusCode >= 500:
+		return RetryOnServerError
+	default:
+		return ""
+	}
+}
+
+func classifyPluginError(err error) string {
+	return RetryOnPluginError
+}
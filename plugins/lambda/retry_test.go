@@ -0,0 +1,62 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRetry(t *testing.T) {
+	p := newTestPlugin(t, `{
+    "retry": {"max_attempts": 3, "initial_backoff_ms": 1},
+    "retries": {"bundle": {"max_attempts": 1}}
+  }`)
+	serverError := &APIError{StatusCode: http.StatusInternalServerError}
+	badRequest := &APIError{StatusCode: http.StatusBadRequest}
+
+	cases := []struct {
+		note      string
+		component string
+		errs      []error
+		attempts  int
+		succeeds  bool
+	}{
+		{"success", extensionsAPIRetryComponent, []error{nil}, 1, true},
+		{"server error retried", extensionsAPIRetryComponent, []error{serverError, serverError, nil}, 3, true},
+		{"attempts exhausted", extensionsAPIRetryComponent, []error{serverError, serverError, serverError, nil}, 3, false},
+		{"client error not retried", extensionsAPIRetryComponent, []error{badRequest, nil}, 1, false},
+		{"override", "bundle", []error{errors.New("download failed"), nil}, 1, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+			attempts := 0
+			err := p.retry(context.Background(), tc.component, classifyAPIError, func() error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+			if attempts != tc.attempts {
+				t.Fatalf("Expected %d attempts, got %d", tc.attempts, attempts)
+			}
+			if (err == nil) != tc.succeeds {
+				t.Fatalf("Expected success to be %v, got error %v", tc.succeeds, err)
+			}
+		})
+	}
+}
+
+func TestRetryOnClasses(t *testing.T) {
+	p := newTestPlugin(t, `{"retry": {"max_attempts": 3, "initial_backoff_ms": 1, "retry_on": ["server_error"]}}`)
+	attempts := 0
+	err := p.retry(context.Background(), extensionsAPIRetryComponent, classifyAPIError, func() error {
+		attempts++
+		return &APIError{StatusCode: http.StatusTooManyRequests}
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("Expected throttling not to be retried, got %d attempts, %v", attempts, err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// invokeFailedPath is the path of the decision log event that marks a failed invoke.
+const invokeFailedPath = "lambda_extension/invoke_failed"
+
+// sandbox identifies the execution environment that the extension runs in. Lambda doesn't expose
+// an identifier for it, so a random one is generated when the extension initializes. It is
+// included in the logs, the journal, and the metrics, so the churn of execution environments
+// and the work done by each one can be analyzed.
+type sandbox struct {
+	mtx     sync.Mutex
+	id      string
+	created time.Time
+	invokes int
+}
+
+func newSandbox(created time.Time) *sandbox {
+	return &sandbox{id: randomUUID(), created: created}
+}
+
+// invoke counts an invoke handled by the sandbox.
+func (s *sandbox) invoke() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.invokes++
+}
+
+// lifetime returns how long the sandbox has existed, and the number of invokes it handled.
+func (s *sandbox) lifetime(now time.Time) (time.Duration, int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return now.Sub(s.created), s.invokes
+}
+
+// sandboxCreated reports that the sandbox was created.
+func (p *Plugin) sandboxCreated() {
+	p.logger.Info("Sandbox %s created.", p.sandbox.id)
+	err := p.emf.write(functionDimensions(), []emfMetric{{name: "SandboxCreated", unit: emfCount, value: 1}})
+	if err != nil {
+		p.logger.Warn("Failed to write sandbox metrics, %v", err)
+	}
+}
+
+// failedInvokes describe the shutdown reasons that mean the current invoke failed, the metrics
+// they are reported with, and the result of the decision log event that marks them.
+var failedInvokes = map[string]struct{ description, metric, annotation string }{
+	FailureShutdownReason: {description: "crashed", metric: "FunctionCrashed", annotation: "function_crashed"},
+	TimeoutShutdownReason: {description: "timed out", metric: "FunctionTimedOut", annotation: "timed_out"},
+}
+
+// invokeFailed reports that the function crashed or timed out, if the shutdown reason says so,
+// along with the request that was being handled. OPA encodes decision log events when they're
+// logged, so the decisions made for the request can't be annotated with the failure. Instead, a
+// marker event with the next decision ID of the request is logged, which is uploaded with them
+// when the decision logs are flushed during the shutdown.
+func (p *Plugin) invokeFailed(ctx context.Context, reason string) {
+	failed, ok := failedInvokes[reason]
+	if !ok {
+		return
+	}
+	requestID := p.decisionIDs.current()
+	p.logger.Error("Function %s while handling request %q.", failed.description, requestID)
+	err := p.emf.write(functionDimensions(), []emfMetric{{name: failed.metric, unit: emfCount, value: 1}})
+	if err != nil {
+		p.logger.Warn("Failed to write failed invoke metrics, %v", err)
+	}
+	if err := p.logInvokeFailed(ctx, requestID, failed.annotation); err != nil {
+		p.logger.Warn("Failed to log the failed invoke, %v", err)
+	}
+}
+
+// sandboxShutdown reports why the sandbox is shutting down, how long it existed, and how many
+// invokes it handled.
+func (p *Plugin) sandboxShutdown(reason string) {
+	lifetime, invokes := p.sandbox.lifetime(time.Now())
+	p.logger.Info("Sandbox %s shutting down, reason %q, after %v and %d invokes.", p.sandbox.id, reason, lifetime, invokes)
+	dimensions := functionDimensions()
+	dimensions["ShutdownReason"] = reason
+	err := p.emf.write(dimensions, []emfMetric{
+		{name: "SandboxLifetime", unit: emfSeconds, value: lifetime.Seconds()},
+		{name: "SandboxInvokes", unit: emfCount, value: float64(invokes)},
+	})
+	if err != nil {
+		p.logger.Warn("Failed to write sandbox metrics, %v", err)
+	}
+}
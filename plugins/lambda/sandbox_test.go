@@ -0,0 +1,134 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins/logs"
+)
+
+func TestSandboxLifetime(t *testing.T) {
+	created := time.Now()
+	s := newSandbox(created)
+	if len(s.id) != 36 {
+		t.Fatalf("Expected a UUID, got %q", s.id)
+	}
+	s.invoke()
+	s.invoke()
+	lifetime, invokes := s.lifetime(created.Add(time.Minute))
+	if lifetime != time.Minute || invokes != 2 {
+		t.Fatalf("Expected a lifetime of 1m and 2 invokes, got %v and %d", lifetime, invokes)
+	}
+}
+
+func TestSandboxShutdownMetrics(t *testing.T) {
+	p := newTestPlugin(t, `{"emf_namespace": "OPA"}`)
+	var out bytes.Buffer
+	p.emf.out = &out
+	p.sandbox.invoke()
+
+	p.sandboxShutdown("spindown")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["SandboxID"] != p.sandbox.id || record["ShutdownReason"] != "spindown" {
+		t.Fatalf("Expected the sandbox ID and shutdown reason, got %v", record)
+	}
+	if record["SandboxInvokes"] != 1.0 {
+		t.Fatalf("Expected 1 invoke, got %v", record["SandboxInvokes"])
+	}
+}
+
+func TestInvokeFailed(t *testing.T) {
+	p := newTestPlugin(t, `{"emf_namespace": "OPA"}`)
+	var out bytes.Buffer
+	p.emf.out = &out
+	p.decisionIDs.invoke("8476a536-e9f4-11e8-9739-2dfe598c3fcd")
+
+	p.invokeFailed(context.Background(), FailureShutdownReason)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["FunctionCrashed"] != 1.0 {
+		t.Fatalf("Expected a crash metric, got %v", record)
+	}
+	if errs := p.recentErrors.all(); len(errs) != 1 || !strings.Contains(errs[0], "8476a536-e9f4-11e8-9739-2dfe598c3fcd") {
+		t.Fatalf("Expected an error with the request ID, got %v", errs)
+	}
+
+	out.Reset()
+	p.invokeFailed(context.Background(), TimeoutShutdownReason)
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["FunctionTimedOut"] != 1.0 {
+		t.Fatalf("Expected a timeout metric, got %v", record)
+	}
+
+	out.Reset()
+	p.invokeFailed(context.Background(), "spindown")
+	if out.Len() != 0 {
+		t.Fatalf("Expected no metrics for a spindown, got %s", out.String())
+	}
+}
+
+// testDecisionLogger is a decision logger plugin that keeps the events it's given.
+type testDecisionLogger struct {
+	events []logs.EventV1
+}
+
+func (l *testDecisionLogger) Start(context.Context) error { return nil }
+
+func (l *testDecisionLogger) Stop(context.Context) {}
+
+func (l *testDecisionLogger) Reconfigure(context.Context, interface{}) {}
+
+func (l *testDecisionLogger) Log(_ context.Context, event logs.EventV1) error {
+	l.events = append(l.events, event)
+	return nil
+}
+
+func TestInvokeFailedDecisionLog(t *testing.T) {
+	p := newTestPlugin(t, `{}`)
+	logger := &testDecisionLogger{}
+	p.manager.Register("test_logger", logger)
+	config, err := logs.ParseConfig([]byte(`{"plugin": "test_logger"}`), nil, []string{"test_logger"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.manager.Register(logs.Name, logs.New(config, p.manager))
+	p.decisionIDs.invoke("8476a536-e9f4-11e8-9739-2dfe598c3fcd")
+	p.NextDecisionID()
+
+	p.invokeFailed(context.Background(), FailureShutdownReason)
+	p.invokeFailed(context.Background(), TimeoutShutdownReason)
+
+	if len(logger.events) != 2 {
+		t.Fatalf("Expected 2 decision log events, got %d", len(logger.events))
+	}
+	for i, annotation := range []string{"function_crashed", "timed_out"} {
+		event := logger.events[i]
+		if event.Path != invokeFailedPath || !strings.HasPrefix(event.DecisionID, "8476a536-e9f4-11e8-9739-2dfe598c3fcd-") {
+			t.Fatalf("Expected a marker event for the request, got %v", event)
+		}
+		input := (*event.Input).(map[string]interface{})
+		result := (*event.Result).(map[string]interface{})
+		if input["request_id"] != "8476a536-e9f4-11e8-9739-2dfe598c3fcd" || result[annotation] != true {
+			t.Fatalf("Expected the request ID and %s, got %v and %v", annotation, input, result)
+		}
+	}
+	if logger.events[0].DecisionID != "8476a536-e9f4-11e8-9739-2dfe598c3fcd-2" {
+		t.Fatalf("Expected the next decision ID of the request, got %q", logger.events[0].DecisionID)
+	}
+}
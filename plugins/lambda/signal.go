@@ -0,0 +1,35 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build !windows
+// +build !windows
+
+package lambda
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDumpSignal calls dump whenever the process receives SIGUSR1, until the returned function
+// is called.
+func notifyDumpSignal(dump func()) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for {
+			select {
+			case <-signals:
+				dump()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
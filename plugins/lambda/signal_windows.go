@@ -0,0 +1,9 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+// notifyDumpSignal does nothing on Windows, which doesn't have SIGUSR1.
+func notifyDumpSignal(dump func()) func() {
+	return func() {}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins/bundle"
+)
+
+// Bundle staleness actions
+const (
+	// WarnStalenessAction logs a warning when a bundle is stale.
+	WarnStalenessAction = "warn"
+	// FailClosedStalenessAction reports an exit error to the Lambda service and exits when a
+	// bundle is stale, so the current invoke fails and the next one gets a fresh execution
+	// environment that downloads the bundle again.
+	FailClosedStalenessAction = "fail_closed"
+)
+
+const (
+	bundleStaleErrorType = "Extension.BundleStale"
+	// the staleness of the bundles is reported at most once per interval
+	stalenessReportInterval = time.Minute
+)
+
+// stalenessMonitor tracks how stale the bundles were when the bundle plugin last tried to refresh
+// them. A bundle is as stale as the time from the last successful request, including "not
+// modified" responses, to the last request, or from the start of the extension if the bundle was
+// never downloaded successfully. Staleness only changes when a refresh is attempted, so a bundle
+// doesn't become stale because the environment was frozen, or because the bundle plugin wasn't
+// triggered, e.g. because of its trigger strategy, an open circuit breaker, or a revision pin.
+type stalenessMonitor struct {
+	mtx        sync.Mutex
+	started    time.Time
+	bundles    map[string]time.Duration // staleness as of the last request, by bundle name
+	lastReport time.Time
+}
+
+func newStalenessMonitor(started time.Time) *stalenessMonitor {
+	return &stalenessMonitor{started: started, bundles: map[string]time.Duration{}}
+}
+
+func (m *stalenessMonitor) update(status bundle.Status) {
+	if status.LastRequest.IsZero() {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	lastSuccess := status.LastSuccessfulRequest
+	if lastSuccess.IsZero() {
+		lastSuccess = m.started
+	}
+	staleness := status.LastRequest.Sub(lastSuccess)
+	if staleness < 0 {
+		staleness = 0
+	}
+	m.bundles[status.Name] = staleness
+}
+
+// staleness returns the staleness of every bundle that the bundle plugin has tried to refresh.
+func (m *stalenessMonitor) staleness() map[string]time.Duration {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	staleness := make(map[string]time.Duration, len(m.bundles))
+	for name, d := range m.bundles {
+		staleness[name] = d
+	}
+	return staleness
+}
+
+// shouldReport returns true if the staleness hasn't been reported for the report interval.
+func (m *stalenessMonitor) shouldReport(now time.Time) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if now.Sub(m.lastReport) < stalenessReportInterval {
+		return false
+	}
+	m.lastReport = now
+	return true
+}
+
+// checkStaleness compares the staleness of the bundles to the SLA, reports it, and takes the
+// staleness action if a bundle exceeds the SLA. It is called on every invoke, after the plugins
+// have been triggered, so the result of a refresh on the same invoke is taken into account.
+func (p *Plugin) checkStaleness(ctx context.Context) {
+	sla := time.Duration(*p.config.BundleStalenessSLA) * time.Second
+	if sla <= 0 {
+		return
+	}
+	staleness := p.staleness.staleness()
+	names := make([]string, 0, len(staleness))
+	stale := []string{}
+	for name, d := range staleness {
+		names = append(names, name)
+		if d > sla {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+
+	if len(stale) > 0 && *p.config.BundleStalenessAction == FailClosedStalenessAction {
+		p.logger.Error("Bundles %v are stale, their staleness exceeds the SLA of %v.", stale, sla)
+		p.reportExitError(ctx, bundleStaleErrorType)
+		exit(1)
+		return
+	}
+	if !p.staleness.shouldReport(p.pluginTime(bundle.Name, time.Now())) {
+		return
+	}
+	if len(stale) > 0 {
+		p.logger.Warn("Bundles %v are stale, their staleness exceeds the SLA of %v.", stale, sla)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		exceeded := 0.0
+		if staleness[name] > sla {
+			exceeded = 1
+		}
+		dimensions := functionDimensions()
+		dimensions["Bundle"] = name
+		err := p.emf.write(dimensions, []emfMetric{
+			{name: "BundleStaleness", unit: emfSeconds, value: staleness[name].Seconds()},
+			{name: "BundleStalenessSLAExceeded", unit: emfCount, value: exceeded},
+		})
+		if err != nil {
+			p.logger.Warn("Failed to write bundle staleness metrics, %v", err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins/bundle"
+)
+
+func TestStalenessMonitor(t *testing.T) {
+	started := time.Now()
+	m := newStalenessMonitor(started)
+	m.update(bundle.Status{Name: "fresh", LastSuccessfulRequest: started.Add(time.Minute), LastRequest: started.Add(time.Minute)})
+	// the last request failed 9m after the last successful one
+	m.update(bundle.Status{Name: "failing", LastSuccessfulRequest: started.Add(time.Minute), LastRequest: started.Add(10 * time.Minute)})
+	// never downloaded successfully, so stale since the start
+	m.update(bundle.Status{Name: "missing", LastRequest: started.Add(5 * time.Minute)})
+	// never requested, e.g. because the environment was frozen, so not judged
+	m.update(bundle.Status{Name: "frozen"})
+
+	expected := map[string]time.Duration{"fresh": 0, "failing": 9 * time.Minute, "missing": 5 * time.Minute}
+	if staleness := m.staleness(); !reflect.DeepEqual(staleness, expected) {
+		t.Fatalf("Expected staleness %v, got %v", expected, staleness)
+	}
+
+	if !m.shouldReport(started) {
+		t.Fatal("Expected the first report")
+	}
+	if m.shouldReport(started.Add(time.Second)) {
+		t.Fatal("Expected no report within the report interval")
+	}
+}
+
+func TestStalenessNotJudgedWithoutRequests(t *testing.T) {
+	p := newTestPlugin(t, `{"bundle_staleness_sla": 60, "bundle_staleness_action": "fail_closed"}`)
+	p.client = NewClient("127.0.0.1:0")
+	started := time.Now().Add(-time.Hour)
+	p.staleness = newStalenessMonitor(started)
+	// refreshed successfully, then the environment was frozen for an hour and the bundle plugin
+	// hasn't been triggered since
+	p.staleness.update(bundle.Status{Name: "authz", LastSuccessfulRequest: started, LastRequest: started})
+
+	exited := false
+	exit = func(int) { exited = true }
+	defer func() { exit = os.Exit }()
+	p.checkStaleness(context.Background())
+	if exited {
+		t.Fatal("Expected a bundle that wasn't refreshed not to be judged stale")
+	}
+}
+
+func TestStalenessFailClosed(t *testing.T) {
+	p := newTestPlugin(t, `{"bundle_staleness_sla": 60, "bundle_staleness_action": "fail_closed"}`)
+	p.client = NewClient("127.0.0.1:0")
+	p.staleness = newStalenessMonitor(time.Now().Add(-2 * time.Minute))
+	p.staleness.update(bundle.Status{Name: "authz", LastRequest: time.Now()})
+
+	exited := false
+	exit = func(int) { exited = true }
+	defer func() { exit = os.Exit }()
+	p.checkStaleness(context.Background())
+	if !exited {
+		t.Fatal("Expected the extension to exit when a bundle is stale")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/godaddy/opa-lambda-extension-plugin/profiles"
+
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// RunStandalone runs OPA as a pure Lambda extension, without the OPA server or the rest of the
+// `opa run` entrypoint. It constructs the plugin manager from an OPA configuration file, starts
+// the bundle, decision_logs, status, and discovery plugins as configured, as far as the build
+// profile provides them, along with this plugin, and returns once the Lambda service has shut
+// down the environment. If the extension stops handling events because of an error, the plugins
+// are stopped and the error is returned.
+func RunStandalone(ctx context.Context, config []byte) error {
+	manager, err := newStandaloneManager(config)
+	if err != nil {
+		return err
+	}
+	if err := manager.Init(ctx); err != nil {
+		return err
+	}
+	if err := manager.Start(ctx); err != nil {
+		return err
+	}
+	// There is no server to wait for, so the lambda_extension plugin can start handling events
+	// as soon as it has started the other plugins
+	manager.ServerInitialized()
+
+	p := Lookup(manager)
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if p.loopErr != nil {
+		manager.Stop(ctx)
+		return p.loopErr
+	}
+	// The plugins were already stopped while handling the shutdown event, so the manager must not
+	// stop them again
+	return nil
+}
+
+// newStandaloneManager constructs the plugin manager and registers this plugin with it, along with
+// the plugins that the build profile provides. Configuration for a plugin that the profile leaves
+// out is an error, rather than being ignored.
+func newStandaloneManager(config []byte) (*plugins.Manager, error) {
+	config, pluginConfig, err := splitPluginConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := plugins.New(config, extensionName, inmem.New())
+	if err != nil {
+		return nil, err
+	}
+	profile := profiles.Current()
+	if manager.Config.Discovery != nil && !profile.Discovery {
+		return nil, fmt.Errorf("discovery is not available in the %s build profile", profile.Name)
+	}
+	if manager.Config.DecisionLogs != nil && !profile.DecisionLogs {
+		return nil, fmt.Errorf("decision_logs is not available in the %s build profile", profile.Name)
+	}
+	if err := registerStandalonePlugins(manager, pluginConfig); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// splitPluginConfig takes the configuration of this plugin out of the bootstrap configuration if
+// discovery is configured, because OPA doesn't allow plugins to be configured along with
+// discovery. It returns the bootstrap configuration as is otherwise.
+func splitPluginConfig(config []byte) ([]byte, []byte, error) {
+	var parsed map[string]interface{}
+	if err := util.Unmarshal(config, &parsed); err != nil {
+		return nil, nil, err
+	}
+	if parsed["discovery"] == nil {
+		return config, nil, nil
+	}
+	pluginsConfig, _ := parsed["plugins"].(map[string]interface{})
+	pluginConfig, err := json.Marshal(pluginsConfig[Name])
+	if err != nil {
+		return nil, nil, err
+	}
+	delete(pluginsConfig, Name)
+	if len(pluginsConfig) == 0 {
+		delete(parsed, "plugins")
+	}
+	config, err = json.Marshal(parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, pluginConfig, nil
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build !minimal
+// +build !minimal
+
+package lambda
+
+import (
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/plugins/discovery"
+)
+
+// registerStandalonePlugins registers this plugin, and lets the discovery plugin create the
+// bundle, decision_logs, and status plugins, from the bootstrap configuration or, if discovery is
+// configured, from the discovery bundle.
+func registerStandalonePlugins(manager *plugins.Manager, pluginConfig []byte) error {
+	// Without discovery, the lambda_extension plugin is created from the bootstrap configuration
+	// along with the other plugins. With discovery, it has to be registered before discovery runs,
+	// so it is created below from its part of the bootstrap configuration, and any configuration
+	// for it that discovery downloads is ignored.
+	factories := map[string]plugins.Factory{}
+	if pluginConfig == nil {
+		factories[Name] = &PluginFactory{}
+	}
+	disco, err := discovery.New(manager, discovery.Factories(factories))
+	if err != nil {
+		return err
+	}
+	if manager.Plugin(Name) == nil {
+		factory := &PluginFactory{}
+		c, err := factory.Validate(manager, pluginConfig)
+		if err != nil {
+			return err
+		}
+		manager.Register(Name, factory.New(manager, c))
+	}
+	// The discovery plugin can only be triggered if it was configured
+	if manager.Config.Discovery != nil {
+		manager.Register(discovery.Name, disco)
+	}
+	return nil
+}
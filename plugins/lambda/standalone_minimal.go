@@ -0,0 +1,61 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build minimal
+// +build minimal
+
+package lambda
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/plugins/bundle"
+	"github.com/open-policy-agent/opa/plugins/status"
+)
+
+// registerStandalonePlugins registers this plugin, and the bundle and status plugins if they're
+// configured. The discovery plugin isn't used, because it links the decision_logs plugin and the
+// Rego evaluator, so the plugins are created the way discovery creates them from the bootstrap
+// configuration.
+func registerStandalonePlugins(manager *plugins.Manager, _ []byte) error {
+	if manager.Config.Bundle != nil {
+		return fmt.Errorf("the deprecated bundle configuration is not available in the minimal build profile, use bundles")
+	}
+	for name := range manager.Config.Plugins {
+		if name != Name {
+			return fmt.Errorf("plugin %q not registered", name)
+		}
+	}
+	factory := &PluginFactory{}
+	c, err := factory.Validate(manager, manager.Config.Plugins[Name])
+	if err != nil {
+		return err
+	}
+	manager.Register(Name, factory.New(manager, c))
+
+	trigger := plugins.DefaultTriggerMode
+	bundleConfig, err := bundle.NewConfigBuilder().WithBytes(manager.Config.Bundles).WithServices(manager.Services()).
+		WithKeyConfigs(manager.PublicKeys()).WithTriggerMode(&trigger).Parse()
+	if err != nil {
+		return err
+	}
+	statusConfig, err := status.NewConfigBuilder().WithBytes(manager.Config.Status).WithServices(manager.Services()).
+		WithPlugins([]string{Name}).WithTriggerMode(&trigger).Parse()
+	if err != nil {
+		return err
+	}
+	var bundlePlugin *bundle.Plugin
+	if bundleConfig != nil {
+		bundlePlugin = bundle.New(bundleConfig, manager)
+		manager.Register(bundle.Name, bundlePlugin)
+	}
+	if statusConfig != nil {
+		statusPlugin := status.New(statusConfig, manager)
+		manager.Register(status.Name, statusPlugin)
+		if bundlePlugin != nil {
+			bundlePlugin.RegisterBulkListener(status.Name, statusPlugin.BulkUpdateBundleStatus)
+		}
+	}
+	return nil
+}
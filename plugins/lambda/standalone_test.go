@@ -0,0 +1,110 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/godaddy/opa-lambda-extension-plugin/profiles"
+)
+
+// newStandaloneTestServer returns a server that stands in for the Extensions API, and answers
+// every request for the next event with the given status code and event type.
+func newStandaloneTestServer(t *testing.T, statusCode int, eventType string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-01-01/extension/register":
+			w.Header().Set(extensionIdentiferHeader, "id")
+			fmt.Fprintf(w, `{"functionName": "foo", "functionVersion": "1", "handler": "bar"}`)
+		case "/2020-01-01/extension/event/next":
+			w.WriteHeader(statusCode)
+			fmt.Fprintf(w, `{"eventType": %q, "deadlineMs": 60000, "requestId": "bar"}`, eventType)
+		default:
+			t.Errorf("unexpected path sent to test server: %s", r.URL.Path)
+		}
+	}))
+	// strip http:// prefix
+	os.Setenv("AWS_LAMBDA_RUNTIME_API", server.URL[7:])
+	return server
+}
+
+func TestRunStandaloneShutdown(t *testing.T) {
+	server := newStandaloneTestServer(t, http.StatusOK, string(Shutdown))
+	defer server.Close()
+	if err := RunStandalone(context.Background(), []byte(`{}`)); err != nil {
+		t.Fatalf("Expected no error after a shutdown event, got %v", err)
+	}
+}
+
+func TestRunStandaloneLoopError(t *testing.T) {
+	server := newStandaloneTestServer(t, http.StatusInternalServerError, string(Invoke))
+	defer server.Close()
+	if err := RunStandalone(context.Background(), []byte(`{}`)); err == nil {
+		t.Fatal("Expected an error when the extension fails to get the next event")
+	}
+}
+
+func TestStandaloneManagerDiscoveryConfig(t *testing.T) {
+	manager, err := newStandaloneManager([]byte(`{
+    "services": [{"name": "acmecorp", "url": "http://localhost"}],
+    "discovery": {"name": "discovery", "resource": "/discovery"},
+    "plugins": {"lambda_extension": {"trigger_timeout": 3}}
+  }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Lookup(manager)
+	if p == nil {
+		t.Fatal("Expected the lambda_extension plugin to be registered")
+	}
+	if *p.config.TriggerTimeout != 3 {
+		t.Fatalf("Expected the trigger timeout from the bootstrap configuration, got %d", *p.config.TriggerTimeout)
+	}
+}
+
+func TestStandaloneManagerDiscoveryDefaultConfig(t *testing.T) {
+	manager, err := newStandaloneManager([]byte(`{
+    "services": [{"name": "acmecorp", "url": "http://localhost"}],
+    "discovery": {"name": "discovery", "resource": "/discovery"}
+  }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := Lookup(manager); p == nil || *p.config.TriggerTimeout != defaultTriggerTimeout {
+		t.Fatal("Expected the lambda_extension plugin to be registered with the default configuration")
+	}
+}
+
+func TestStandaloneManagerPlugins(t *testing.T) {
+	manager, err := newStandaloneManager([]byte(`{
+    "services": [{"name": "acmecorp", "url": "http://localhost"}],
+    "bundles": {"authz": {"service": "acmecorp"}},
+    "status": {"service": "acmecorp"}
+  }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{Name, "bundle", "status"} {
+		if manager.Plugin(name) == nil {
+			t.Fatalf("Expected the %s plugin to be registered", name)
+		}
+	}
+}
+
+func TestStandaloneManagerProfile(t *testing.T) {
+	_, err := newStandaloneManager([]byte(`{
+    "services": [{"name": "acmecorp", "url": "http://localhost"}],
+    "decision_logs": {"service": "acmecorp"}
+  }`))
+	if profiles.Current().DecisionLogs && err != nil {
+		t.Fatal(err)
+	} else if !profiles.Current().DecisionLogs && err == nil {
+		t.Fatal("Expected an error for decision_logs in a profile without it")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// credentialEnvVars are the environment variables that templates can't read, so the credentials
+// of the function never end up in labels. Lambda sets the first three for the execution role, and
+// the container token when the function gets its credentials from a container credentials
+// endpoint, e.g. with SnapStart.
+var credentialEnvVars = map[string]bool{
+	"AWS_ACCESS_KEY_ID":                 true,
+	"AWS_SECRET_ACCESS_KEY":             true,
+	"AWS_SESSION_TOKEN":                 true,
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN": true,
+}
+
+// secretEnvVarWords are words that mark an environment variable as a secret that templates can't
+// read, e.g. an API token that the function was configured with.
+var secretEnvVarWords = []string{"SECRET", "TOKEN", "PASSWORD"}
+
+// readableEnvVar returns true if templates can read an environment variable.
+func readableEnvVar(name string) bool {
+	if credentialEnvVars[name] {
+		return false
+	}
+	upper := strings.ToUpper(name)
+	for _, word := range secretEnvVarWords {
+		if strings.Contains(upper, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// templateFuncs are the only functions that templates can call, besides the text/template
+// builtins.
+var templateFuncs = template.FuncMap{
+	"env": func(name string) (string, error) {
+		if !readableEnvVar(name) {
+			return "", fmt.Errorf("environment variable %s can't be used in templates", name)
+		}
+		return os.Getenv(name), nil
+	},
+	"date": func(layout string) string {
+		return time.Now().UTC().Format(layout)
+	},
+}
+
+// isGoTemplate returns true if a config value is a text/template rather than a value with ARN
+// placeholders.
+func isGoTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+}
+
+// validateTemplate returns an error if a config value is an invalid template, either a
+// text/template or a value with ARN placeholders.
+func validateTemplate(value string) error {
+	if !isGoTemplate(value) {
+		return validateARNTemplate(value)
+	}
+	_, err := parseTemplate("", value)
+	return err
+}
+
+// expandTemplate expands a config value that is either a text/template, which gets the parts of
+// the ARN as its data, e.g. {{ .Function }}, or a value with ARN placeholders, e.g. {function}.
+func expandTemplate(value string, arn *FunctionARN) (string, error) {
+	if !isGoTemplate(value) {
+		return expandARNTemplate(value, arn), nil
+	}
+	tmpl, err := parseTemplate("", value)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, arn); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	os.Setenv("STAGE", "prod")
+	defer os.Unsetenv("STAGE")
+	arn := &FunctionARN{Partition: "aws", Region: "us-west-2", AccountID: "123456789012", Function: "my-function", Qualifier: "3"}
+
+	got, err := expandTemplate(`{{ .AccountID }}/{{ .Function }}/{{ env "STAGE" }}/{{ date "2006" }}`, arn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "123456789012/my-function/prod/" + time.Now().UTC().Format("2006"); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+	// values without actions use the ARN placeholders
+	if got, err := expandTemplate("{function}", arn); err != nil || got != "my-function" {
+		t.Fatalf("Expected 'my-function', got %q, %v", got, err)
+	}
+}
+
+func TestTemplateRestrictions(t *testing.T) {
+	arn := &FunctionARN{}
+	for _, name := range []string{"AWS_SECRET_ACCESS_KEY", "AWS_CONTAINER_AUTHORIZATION_TOKEN", "GITHUB_TOKEN", "db_password"} {
+		if _, err := expandTemplate(fmt.Sprintf(`{{ env %q }}`, name), arn); err == nil {
+			t.Fatalf("Expected an error for the secret environment variable %s", name)
+		}
+	}
+	if err := validateTemplate(`{{ exec "ls" }}`); err == nil {
+		t.Fatal("Expected an error for an unknown function")
+	}
+	if _, err := expandTemplate(`{{ .Alias }}`, arn); err == nil {
+		t.Fatal("Expected an error for an unknown field")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"fmt"
+	"time"
+)
+
+// Trigger strategies
+const (
+	// IntervalTriggerStrategy triggers plugins on an invoke once the minimum trigger threshold has
+	// elapsed since they were last triggered.
+	IntervalTriggerStrategy = "interval"
+	// EveryInvokeTriggerStrategy triggers plugins on every invoke.
+	EveryInvokeTriggerStrategy = "every_invoke"
+	// EveryNInvokesTriggerStrategy triggers plugins on the first invoke, and then again after
+	// every N invokes.
+	EveryNInvokesTriggerStrategy = "every_n_invokes"
+)
+
+// TriggerStrategy decides whether plugins should be triggered when the extension receives an
+// invoke event.
+type TriggerStrategy interface {
+	// ShouldTrigger is called once for every invoke. When it returns true, the plugins are
+	// triggered, so implementations can treat it as the time of the last trigger.
+	ShouldTrigger(now time.Time) bool
+}
+
+// TriggerStrategyFactory creates a trigger strategy from the threshold and the invoke count that
+// are configured for it.
+type TriggerStrategyFactory func(threshold time.Duration, invokeCount int) (TriggerStrategy, error)
+
+var triggerStrategyFactories = map[string]TriggerStrategyFactory{
+	IntervalTriggerStrategy: func(threshold time.Duration, _ int) (TriggerStrategy, error) {
+		if threshold < 0 {
+			return nil, fmt.Errorf("minimum trigger threshold must not be negative")
+		}
+		return &intervalTriggerStrategy{threshold: threshold}, nil
+	},
+	EveryInvokeTriggerStrategy: func(time.Duration, int) (TriggerStrategy, error) {
+		return &everyNInvokesTriggerStrategy{n: 1}, nil
+	},
+	EveryNInvokesTriggerStrategy: func(_ time.Duration, invokeCount int) (TriggerStrategy, error) {
+		if invokeCount < 1 {
+			return nil, fmt.Errorf("trigger invoke count must be at least 1")
+		}
+		return &everyNInvokesTriggerStrategy{n: invokeCount}, nil
+	},
+}
+
+// RegisterTriggerStrategy makes a custom trigger strategy available under a name, so it can be
+// selected with trigger_strategy or the strategy of a plugin in triggers. Custom builds must
+// register their strategies before the plugin configuration is validated, e.g. in an init
+// function. The built-in strategies can't be replaced.
+func RegisterTriggerStrategy(name string, factory TriggerStrategyFactory) error {
+	if _, ok := triggerStrategyFactories[name]; ok {
+		return fmt.Errorf("trigger strategy %q is already registered", name)
+	}
+	triggerStrategyFactories[name] = factory
+	return nil
+}
+
+// NewTriggerStrategy returns the trigger strategy registered under a name. The threshold is only
+// used by the interval strategy, and the invoke count is only used by the every_n_invokes
+// strategy.
+func NewTriggerStrategy(name string, threshold time.Duration, invokeCount int) (TriggerStrategy, error) {
+	factory, ok := triggerStrategyFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown trigger strategy %q", name)
+	}
+	return factory(threshold, invokeCount)
+}
+
+type intervalTriggerStrategy struct {
+	threshold       time.Duration
+	lastTriggerTime time.Time
+}
+
+func (s *intervalTriggerStrategy) ShouldTrigger(now time.Time) bool {
+	if now.Sub(s.lastTriggerTime) <= s.threshold {
+		return false
+	}
+	s.lastTriggerTime = now
+	return true
+}
+
+type everyNInvokesTriggerStrategy struct {
+	n       int
+	invokes int
+}
+
+func (s *everyNInvokesTriggerStrategy) ShouldTrigger(now time.Time) bool {
+	trigger := s.invokes%s.n == 0
+	s.invokes++
+	return trigger
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTriggerStrategies(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name        string
+		strategy    string
+		threshold   time.Duration
+		invokeCount int
+		invokes     []time.Duration
+		expected    []bool
+	}{
+		{
+			name:      "interval",
+			strategy:  IntervalTriggerStrategy,
+			threshold: 10 * time.Second,
+			invokes:   []time.Duration{0, 5 * time.Second, 11 * time.Second, 15 * time.Second, 30 * time.Second},
+			expected:  []bool{true, false, true, false, true},
+		},
+		{
+			name:     "every invoke",
+			strategy: EveryInvokeTriggerStrategy,
+			invokes:  []time.Duration{0, time.Second, 2 * time.Second},
+			expected: []bool{true, true, true},
+		},
+		{
+			name:        "every n invokes",
+			strategy:    EveryNInvokesTriggerStrategy,
+			invokeCount: 3,
+			invokes:     []time.Duration{0, 0, 0, 0, 0, 0, 0},
+			expected:    []bool{true, false, false, true, false, false, true},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strategy, err := NewTriggerStrategy(tc.strategy, tc.threshold, tc.invokeCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := []bool{}
+			for _, offset := range tc.invokes {
+				actual = append(actual, strategy.ShouldTrigger(start.Add(offset)))
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTriggerStrategyInvalid(t *testing.T) {
+	if _, err := NewTriggerStrategy("foo", 0, 0); err == nil {
+		t.Fatal("Expected an error for an unknown trigger strategy")
+	}
+	if _, err := NewTriggerStrategy(EveryNInvokesTriggerStrategy, 0, 0); err == nil {
+		t.Fatal("Expected an error for an invoke count of 0")
+	}
+}
+
+type countingTriggerStrategy struct {
+	calls int
+}
+
+func (s *countingTriggerStrategy) ShouldTrigger(now time.Time) bool {
+	s.calls++
+	return s.calls == 2
+}
+
+func TestRegisterTriggerStrategy(t *testing.T) {
+	factory := func(time.Duration, int) (TriggerStrategy, error) {
+		return &countingTriggerStrategy{}, nil
+	}
+	if err := RegisterTriggerStrategy("second_invoke", factory); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(triggerStrategyFactories, "second_invoke")
+	if err := RegisterTriggerStrategy(IntervalTriggerStrategy, factory); err == nil {
+		t.Fatal("Expected an error when replacing a built-in trigger strategy")
+	}
+
+	p := newTestPlugin(t, `{"trigger_strategy": "second_invoke"}`)
+	if p.triggerStrategy.ShouldTrigger(time.Now()) || !p.triggerStrategy.ShouldTrigger(time.Now()) {
+		t.Fatal("Expected the registered trigger strategy to be used")
+	}
+}
+
+// triggerablePlugin is a plugin that counts its triggers and fails them with err.
+type triggerablePlugin struct {
+	triggers int
+	err      error
+}
+
+func (p *triggerablePlugin) Start(ctx context.Context) error {
+	return nil
+}
+
+func (p *triggerablePlugin) Stop(ctx context.Context) {
+}
+
+func (p *triggerablePlugin) Reconfigure(ctx context.Context, config interface{}) {
+}
+
+func (p *triggerablePlugin) Trigger(ctx context.Context) error {
+	p.triggers++
+	return p.err
+}
+
+func TestPluginsToTriggerPerPluginStrategy(t *testing.T) {
+	p := newTestPlugin(t, `{
+    "trigger_strategy": "every_invoke",
+    "triggers": {"bundle": {"strategy": "every_n_invokes", "invoke_count": 2}}
+  }`)
+	for _, name := range []string{"bundle", "decision_logs", "status"} {
+		p.manager.Register(name, &triggerablePlugin{})
+	}
+
+	expected := [][]string{
+		{"bundle", "decision_logs", "status"},
+		{"decision_logs", "status"},
+		{"bundle", "decision_logs", "status"},
+	}
+	for i, names := range expected {
+		if actual := p.pluginsToTrigger(time.Now()); !reflect.DeepEqual(actual, names) {
+			t.Fatalf("Expected invoke %d to trigger %v, got %v", i+1, names, actual)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	goruntime "runtime"
+	"time"
+)
+
+// resourceUsage is the resources used by the extension process since it started.
+type resourceUsage struct {
+	cpu         time.Duration
+	allocBytes  uint64
+	allocations uint64
+}
+
+func readResourceUsage() resourceUsage {
+	var stats goruntime.MemStats
+	goruntime.ReadMemStats(&stats)
+	return resourceUsage{
+		cpu:         processCPUTime(),
+		allocBytes:  stats.TotalAlloc,
+		allocations: stats.Mallocs,
+	}
+}
+
+func (u resourceUsage) sub(previous resourceUsage) resourceUsage {
+	return resourceUsage{
+		cpu:         u.cpu - previous.cpu,
+		allocBytes:  u.allocBytes - previous.allocBytes,
+		allocations: u.allocations - previous.allocations,
+	}
+}
+
+// emitInvokeUsage writes the resources that the extension process used since the previous invoke
+// as metrics, including the time spent evaluating policies in the OPA server, so the cost of the
+// extension can be told apart from the cost of the function.
+func (p *Plugin) emitInvokeUsage(overhead time.Duration) {
+	if !*p.config.EMFInvokeMetrics {
+		return
+	}
+	usage := readResourceUsage()
+	delta := usage.sub(p.lastUsage)
+	p.lastUsage = usage
+	err := p.emf.write(functionDimensions(), []emfMetric{
+		{name: "ExtensionCPUTime", unit: emfMilliseconds, value: float64(delta.cpu) / float64(time.Millisecond)},
+		{name: "ExtensionAllocatedBytes", unit: emfBytes, value: float64(delta.allocBytes)},
+		{name: "ExtensionAllocations", unit: emfCount, value: float64(delta.allocations)},
+		{name: "ExtensionInvokeOverhead", unit: emfMilliseconds, value: float64(overhead) / float64(time.Millisecond)},
+	})
+	if err != nil {
+		p.logger.Warn("Failed to write invoke metrics, %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import "time"
+
+// processCPUTime always returns 0 on Windows, which Lambda doesn't run extensions on.
+func processCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"sync"
+	"time"
+)
+
+// watchdog detects when the event loop stops making progress. Once an event has been received
+// from the Lambda service, the watchdog is armed, and if the event is not fully handled before
+// the watchdog expires, onTimeout is called. Without it, a plugin that hangs during a trigger
+// would leave the extension in a zombie state that holds up the next invoke and consumes the
+// shutdown window without doing anything useful.
+type watchdog struct {
+	mtx       sync.Mutex
+	timer     *time.Timer
+	onTimeout func(event *NextEventResponse, elapsed time.Duration)
+}
+
+func newWatchdog(onTimeout func(event *NextEventResponse, elapsed time.Duration)) *watchdog {
+	return &watchdog{onTimeout: onTimeout}
+}
+
+// arm starts watching the handling of an event. A timeout of zero or less disables the watchdog
+// for the event.
+func (w *watchdog) arm(event *NextEventResponse, timeout time.Duration) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if timeout <= 0 {
+		return
+	}
+	armed := time.Now()
+	w.timer = time.AfterFunc(timeout, func() {
+		w.onTimeout(event, time.Since(armed))
+	})
+}
+
+// disarm signals that the event being watched has been handled.
+func (w *watchdog) disarm() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
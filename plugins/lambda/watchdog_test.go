@@ -0,0 +1,75 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package lambda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdogExpires(t *testing.T) {
+	expired := make(chan *NextEventResponse, 1)
+	w := newWatchdog(func(event *NextEventResponse, elapsed time.Duration) {
+		expired <- event
+	})
+	event := &NextEventResponse{EventType: Invoke, RequestID: "foo"}
+	w.arm(event, 10*time.Millisecond)
+	select {
+	case got := <-expired:
+		if got != event {
+			t.Fatalf("Expected watchdog to expire with event %v, got %v", event, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected watchdog to expire")
+	}
+}
+
+func TestWatchdogDisarm(t *testing.T) {
+	expired := make(chan *NextEventResponse, 1)
+	w := newWatchdog(func(event *NextEventResponse, elapsed time.Duration) {
+		expired <- event
+	})
+	w.arm(&NextEventResponse{EventType: Invoke}, 50*time.Millisecond)
+	w.disarm()
+	// a zero timeout disables the watchdog for the event
+	w.arm(&NextEventResponse{EventType: Shutdown}, 0)
+	select {
+	case got := <-expired:
+		t.Fatalf("Expected watchdog not to expire, but it expired with %v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatchdogTimeoutCappedByDeadline(t *testing.T) {
+	p := newTestPlugin(t, `{"watchdog_timeout": 15, "trigger_timeout": 2}`)
+	event := &NextEventResponse{EventType: Invoke, DeadlineMs: time.Now().Add(10*time.Second).UnixNano() / int64(time.Millisecond)}
+	if timeout := p.watchdogTimeout(event); timeout > 10*time.Second || timeout < 9*time.Second {
+		t.Fatalf("Expected the timeout to be capped by the deadline, got %v", timeout)
+	}
+	if timeout := p.watchdogTimeout(&NextEventResponse{EventType: Invoke}); timeout != 15*time.Second {
+		t.Fatalf("Expected the configured timeout without a deadline, got %v", timeout)
+	}
+}
+
+func TestWatchdogSlowTriggerPastDeadline(t *testing.T) {
+	p := newTestPlugin(t, `{"watchdog_timeout": 15, "trigger_timeout": 1}`)
+	expired := make(chan *NextEventResponse, 1)
+	w := newWatchdog(func(event *NextEventResponse, elapsed time.Duration) {
+		expired <- event
+	})
+	event := &NextEventResponse{EventType: Invoke, DeadlineMs: time.Now().Add(10*time.Millisecond).UnixNano() / int64(time.Millisecond)}
+	timeout := p.watchdogTimeout(event)
+	if timeout != time.Second {
+		t.Fatalf("Expected the timeout not to go below the trigger timeout, got %v", timeout)
+	}
+	w.arm(event, timeout)
+	// a trigger that takes longer than the deadline, but not longer than the trigger timeout
+	time.Sleep(200 * time.Millisecond)
+	w.disarm()
+	select {
+	case got := <-expired:
+		t.Fatalf("Expected watchdog not to expire, but it expired with %v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
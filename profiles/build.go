@@ -0,0 +1,66 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+package profiles
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	opaversion "github.com/open-policy-agent/opa/version"
+)
+
+const modulePath = "github.com/godaddy/opa-lambda-extension-plugin"
+
+// Version and Commit identify the build. They are set by the Makefile with
+// -ldflags "-X github.com/godaddy/opa-lambda-extension-plugin/profiles.Version=...".
+var (
+	Version = ""
+	Commit  = ""
+)
+
+// BuildInfo describes a build of the extension.
+type BuildInfo struct {
+	// Version is the version of this module, e.g. v0.2.0, or "(devel)" for a local build.
+	Version string `json:"version"`
+	// Commit is the git SHA that was built, if it was set at build time.
+	Commit string `json:"commit,omitempty"`
+	// OPAVersion is the version of OPA that the extension was built with.
+	OPAVersion string `json:"opa_version"`
+	// GoVersion is the version of Go that the extension was built with.
+	GoVersion string `json:"go_version"`
+	// Profile is the build profile, which tells the features that are enabled.
+	Profile Profile `json:"profile"`
+}
+
+// Build returns the build info of the extension. If the version wasn't set at build time, it's
+// read from the module information embedded by Go, which has the version of this module when
+// a custom binary depends on it.
+func Build() BuildInfo {
+	return BuildInfo{
+		Version:    moduleVersion(),
+		Commit:     Commit,
+		OPAVersion: opaversion.Version,
+		GoVersion:  runtime.Version(),
+		Profile:    Current(),
+	}
+}
+
+func moduleVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
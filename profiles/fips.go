@@ -0,0 +1,17 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build goexperiment.boringcrypto
+// +build goexperiment.boringcrypto
+
+package profiles
+
+import (
+	"crypto/boring"
+	// restrict TLS to FIPS-approved settings
+	_ "crypto/tls/fipsonly"
+)
+
+func fipsEnabled() bool {
+	return boring.Enabled()
+}
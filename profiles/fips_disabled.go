@@ -0,0 +1,11 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build !goexperiment.boringcrypto
+// +build !goexperiment.boringcrypto
+
+package profiles
+
+func fipsEnabled() bool {
+	return false
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+//go:build !minimal
+// +build !minimal
+
+package profiles
+
+var current = Profile{
+	Name:          "full",
+	RuntimePlugin: true,
+	Pprof:         true,
+	Discovery:     true,
+	DecisionLogs:  true,
+	PolicyTests:   true,
+}
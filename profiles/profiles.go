@@ -0,0 +1,40 @@
+// Copyright (c) 2021 GoDaddy Operating Company, LLC. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT
+
+// Package profiles describes the build profile that the extension was compiled with, and the
+// extension checks it to decide what it registers and which options it accepts. The full profile
+// is the default. The minimal profile is selected with the minimal build tag, and leaves out
+// everything that evaluates Rego or serves OPA's API: the OPA runtime, the discovery and
+// decision_logs plugins, which link the OPA server and the Rego evaluator with its builtins, the
+// policy tests, and the pprof endpoints. What's left downloads bundles and reports status.
+// Independently of the profile, building with GOEXPERIMENT=boringcrypto produces a build that
+// uses FIPS 140-2 validated cryptography.
+package profiles
+
+// Profile describes what a build of the extension includes.
+type Profile struct {
+	// Name is the name of the profile, i.e. "full" or "minimal".
+	Name string `json:"name"`
+	// RuntimePlugin is true if the lambda_extension plugin registers itself with the OPA runtime,
+	// i.e. if the plugin can be used with `opa run`. Without it, the plugin can only be used in
+	// standalone mode or registered with a plugin manager directly.
+	RuntimePlugin bool `json:"runtime_plugin"`
+	// Pprof is true if the pprof endpoints can be enabled on the diagnostics listener.
+	Pprof bool `json:"pprof"`
+	// Discovery is true if the standalone extension registers the discovery plugin.
+	Discovery bool `json:"discovery"`
+	// DecisionLogs is true if the standalone extension registers the decision_logs plugin.
+	DecisionLogs bool `json:"decision_logs"`
+	// PolicyTests is true if the policy tests can be run at init.
+	PolicyTests bool `json:"policy_tests"`
+	// FIPS is true if the build uses the BoringCrypto module for cryptography, and restricts TLS
+	// to FIPS-approved settings.
+	FIPS bool `json:"fips"`
+}
+
+// Current returns the profile that the extension was compiled with.
+func Current() Profile {
+	profile := current
+	profile.FIPS = fipsEnabled()
+	return profile
+}